@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"antigravity-cli/internal/config"
+	"antigravity-cli/internal/security"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+)
+
+// bundlePassphraseEnv supplies the bundle passphrase without a prompt
+const bundlePassphraseEnv = "ANTIGRAVITY_BUNDLE_PASSPHRASE"
+
+var (
+	exportAll        bool
+	exportOutput     string
+	exportRecipients []string
+	importIdentity   string
+	importConflict   string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export [names...]",
+	Short: "Export profiles with their tokens to an encrypted bundle",
+	Long: `Write profiles, including tokens and proxy credentials, to an encrypted
+bundle for 'profile import' on another machine.
+
+The bundle is encrypted with a passphrase (prompted, or ` + bundlePassphraseEnv + `),
+or with --recipient to age public keys (age1...). Treat it like a password file.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if exportOutput == "" {
+			return fmt.Errorf("-o/--output is required")
+		}
+		if exportAll == (len(args) > 0) {
+			return fmt.Errorf("name the profiles to export, or use --all")
+		}
+
+		store, err := getStore()
+		if err != nil {
+			return fmt.Errorf("error loading store: %v", err)
+		}
+
+		names := args
+		if exportAll {
+			for profileName := range store.Profiles {
+				names = append(names, profileName)
+			}
+			sort.Strings(names)
+		}
+		var profiles []config.Profile
+		for _, profileName := range names {
+			p, ok := store.GetProfile(profileName)
+			if !ok {
+				return fmt.Errorf("profile '%s' not found", profileName)
+			}
+			profiles = append(profiles, p)
+		}
+
+		var recipients []age.Recipient
+		if len(exportRecipients) > 0 {
+			for _, r := range exportRecipients {
+				recipient, err := age.ParseX25519Recipient(r)
+				if err != nil {
+					return fmt.Errorf("invalid recipient %q: %v", r, err)
+				}
+				recipients = append(recipients, recipient)
+			}
+		} else {
+			passphrase, err := bundlePassphrase(true)
+			if err != nil {
+				return err
+			}
+			recipient, err := age.NewScryptRecipient(passphrase)
+			if err != nil {
+				return err
+			}
+			recipients = append(recipients, recipient)
+		}
+
+		f, err := os.OpenFile(exportOutput, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create bundle: %v", err)
+		}
+		if err := config.WriteBundle(f, profiles, recipients...); err != nil {
+			f.Close()
+			os.Remove(exportOutput)
+			return fmt.Errorf("export failed: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed to write bundle: %v", err)
+		}
+
+		fmt.Printf("✓ Exported %d profile(s) to %s: %s\n", len(profiles), exportOutput, strings.Join(names, ", "))
+		return nil
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import <bundle>",
+	Short: "Import profiles from a bundle made by 'profile export'",
+	Long: `Import profiles from an encrypted bundle. Tokens are re-encrypted under
+this machine's master key.
+
+--on-conflict decides what happens when a profile name already exists:
+  skip       keep the local profile (default)
+  overwrite  replace the local profile with the imported one
+  rename     import under a new name (name-2, name-3, ...)`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policy, err := config.ParseConflictPolicy(importConflict)
+		if err != nil {
+			return err
+		}
+
+		var identities []age.Identity
+		if importIdentity != "" {
+			f, err := os.Open(importIdentity)
+			if err != nil {
+				return fmt.Errorf("failed to open identity file: %v", err)
+			}
+			identities, err = age.ParseIdentities(f)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("invalid identity file: %v", err)
+			}
+		} else {
+			passphrase, err := bundlePassphrase(false)
+			if err != nil {
+				return err
+			}
+			identity, err := age.NewScryptIdentity(passphrase)
+			if err != nil {
+				return err
+			}
+			identities = append(identities, identity)
+		}
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to open bundle: %v", err)
+		}
+		profiles, err := config.ReadBundle(f, identities...)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		store, err := getStore()
+		if err != nil {
+			return fmt.Errorf("error loading store: %v", err)
+		}
+		results, err := store.Import(profiles, policy)
+		if err != nil {
+			return fmt.Errorf("import failed, nothing was changed: %v", err)
+		}
+
+		for _, r := range results {
+			switch r.Action {
+			case "skipped":
+				fmt.Printf("- %s: skipped, a profile with this name exists\n", r.Name)
+			case "renamed":
+				fmt.Printf("✓ %s: imported as '%s'\n", r.Name, r.ImportedAs)
+			default:
+				fmt.Printf("✓ %s: %s\n", r.Name, r.Action)
+			}
+		}
+		return nil
+	},
+}
+
+// bundlePassphrase reads the bundle passphrase from the environment or the terminal
+func bundlePassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(bundlePassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	passphrase, err := promptSecret("Bundle passphrase", confirm)
+	if errors.Is(err, security.ErrPassphraseRequired) {
+		return "", fmt.Errorf("bundle passphrase required: set %s or run interactively", bundlePassphraseEnv)
+	}
+	return passphrase, err
+}
+
+func init() {
+	exportCmd.Flags().BoolVar(&exportAll, "all", false, "Export all profiles")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Bundle file to write")
+	exportCmd.Flags().StringArrayVar(&exportRecipients, "recipient", nil, "Encrypt to an age public key instead of a passphrase (repeatable)")
+	importCmd.Flags().StringVar(&importIdentity, "identity", "", "age identity file for bundles encrypted to recipients")
+	importCmd.Flags().StringVar(&importConflict, "on-conflict", string(config.ConflictSkip), "What to do with existing names (skip/overwrite/rename)")
+
+	profileCmd.AddCommand(exportCmd)
+	profileCmd.AddCommand(importCmd)
+}
@@ -40,14 +40,8 @@ func RunConnect(profileName string) error {
 	fmt.Printf("Connecting to profile: %s\n", profileName)
 
 	// 1. Загрузка профиля
-	homeDir, err := os.UserHomeDir()
+	store, err := getStore()
 	if err != nil {
-		return fmt.Errorf("failed to get home directory: %v", err)
-	}
-	storePath := filepath.Join(homeDir, ".antigravity-cli", "profiles.json")
-	
-	store := config.NewStore(storePath)
-	if err := store.Load(); err != nil {
 		return fmt.Errorf("Failed to load profiles: %v", err)
 	}
 
@@ -62,7 +56,7 @@ func RunConnect(profileName string) error {
 
 	// 2. Поиск порта
 	fmt.Println("DEBUG: Finding free port...")
-	localPort := session.FindFreePort(10000, 20000)
+	localPort := session.FreeTunnelPort()
 	fmt.Printf("DEBUG: Selected local port: %d\n", localPort)
 
 	// 3. Генерация конфига
@@ -118,12 +112,13 @@ func RunConnect(profileName string) error {
 		return fmt.Errorf("failed to create dialer: %v", err)
 	}
 
+	settings := config.Current()
 	httpClient := &http.Client{
 		Transport: &http.Transport{Dial: dialer.Dial},
-		Timeout:   30 * time.Second,
+		Timeout:   time.Duration(settings.Tunnel.ProbeTimeout),
 	}
 
-	resp, err := httpClient.Get("http://clients3.google.com/generate_204")
+	resp, err := httpClient.Get(settings.Tunnel.ProbeURL)
 	if err != nil {
 		killSingBox(singBoxCmd)
 		os.Remove(configPath)
@@ -133,7 +128,7 @@ func RunConnect(profileName string) error {
 	fmt.Println("✅ Tunnel Connection: OK")
 
 	// Проверка IP
-	resp, err = httpClient.Get("http://ip-api.com/json")
+	resp, err = httpClient.Get(settings.Tunnel.IPInfoURL)
 	if err == nil {
 		defer resp.Body.Close()
 		var ipInfo struct {
@@ -159,13 +154,8 @@ func RunConnect(profileName string) error {
 			fmt.Printf("⚠️ Token refresh failed: %v\n", err)
 			fmt.Println("   Continuing with existing token...")
 		} else {
-			// Update profile with new token
-			profile.AccessToken = tokenResp.AccessToken
-			profile.ExpiryTimestamp = time.Now().Unix() + tokenResp.ExpiresIn
-			
-			// Save to store
-			store.Profiles[profileName] = profile
-			if err := store.Save(); err != nil {
+			// Update profile with new token and save it to the store
+			if err := session.SaveRefreshedTokens(store, &profile, tokenResp); err != nil {
 				fmt.Printf("⚠️ Failed to save refreshed token: %v\n", err)
 			} else {
 				fmt.Println("✅ Token refreshed successfully!")
@@ -176,16 +166,31 @@ func RunConnect(profileName string) error {
 
 	// 5. Инъекция
 	fmt.Println("DEBUG: Cleaning up old processes...")
-	utils.KillAntigravity()
-	time.Sleep(1 * time.Second)
+	utils.KillAntigravity() // injection retries while the IDE releases the DB
 
 	dbPath := utils.GetAntigravityDBPath()
+
+	// Remember who the IDE was signed in as, to put it back when the session ends
+	original, err := injection.TakeSnapshot(dbPath, "before session "+profileName)
+	if err != nil {
+		killSingBox(singBoxCmd)
+		os.Remove(configPath)
+		return fmt.Errorf("failed to back up IDE state: %v", err)
+	}
+
 	fmt.Printf("DEBUG: Injecting identity into DB: %s\n", dbPath)
-	if err := injection.InjectIdentity(dbPath, profile.AccessToken, profile.RefreshToken, profile.Email, profile.Name); err != nil {
+	identity := session.IdentityFromProfile(profile)
+	if err := injection.InjectIdentity(dbPath, identity); err != nil {
 		killSingBox(singBoxCmd)
 		os.Remove(configPath)
 		return fmt.Errorf("injection failed: %v", err)
 	}
+	if err := injection.VerifyIdentity(dbPath, identity); err != nil {
+		killSingBox(singBoxCmd)
+		os.Remove(configPath)
+		return fmt.Errorf("❌ injection verification failed, IDE not started: %v", err)
+	}
+	fmt.Println("✅ Injection verified")
 
 	// 6. Запуск IDE
 	idePath := utils.GetAntigravityPath()
@@ -202,6 +207,7 @@ func RunConnect(profileName string) error {
 
 	// 7. Create session and run session menu
 	activeSession = session.NewSession()
+	activeSession.RememberIDEState(original)
 	activeSession.Start(profile, localPort, singBoxCmd, singBoxExec, configPath, ideCmd)
 
 	// Setup Signal Handling
@@ -216,8 +222,9 @@ func RunConnect(profileName string) error {
 		if activeSession != nil && activeSession.IsActive() {
 			fmt.Println("Stopping session...")
 			activeSession.Stop() // Kills IDE and Tunnel
-			time.Sleep(500 * time.Millisecond) // Wait for DB lock release
-			session.ClearIDECredentials()
+			if err := activeSession.EndIDEIdentity(); err != nil {
+				fmt.Printf("⚠️ Failed to reset IDE credentials: %v\n", err)
+			}
 		}
 		os.Exit(0)
 	}()
@@ -228,8 +235,9 @@ func RunConnect(profileName string) error {
 	// Cleanup on exit (Manual Disconnect)
 	fmt.Println("\nStopping tunnel...")
 	activeSession.Stop() // Kill IDE and Tunnel first
-	time.Sleep(500 * time.Millisecond)
-	session.ClearIDECredentials() // Then clear credentials
+	if err := activeSession.EndIDEIdentity(); err != nil { // Then restore or clear credentials
+		fmt.Printf("⚠️ Failed to reset IDE credentials: %v\n", err)
+	}
 	fmt.Println("Session ended.")
 	return nil
 }
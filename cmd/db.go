@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"antigravity-cli/internal/config"
+	"antigravity-cli/internal/injection"
+	"antigravity-cli/internal/session"
+	"antigravity-cli/internal/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	restoreDBPath string
+	inspectDBPath string
+	inspectJSON   bool
+	verifyDBPath  string
+	verifyProfile string
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Inspect and repair the IDE database (state.vscdb)",
+}
+
+var dbBackupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Manage snapshots taken before every IDE database change",
+}
+
+var dbBackupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List IDE database snapshots, newest first",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		snaps, err := injection.ListSnapshots()
+		if err != nil {
+			return fmt.Errorf("failed to list snapshots: %v", err)
+		}
+		if len(snaps) == 0 {
+			fmt.Printf("No snapshots in %s\n", config.BackupDir())
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "ID\tCreated\tReason\tKeys\tDatabase")
+		for _, s := range snaps {
+			present := 0
+			for _, v := range s.Rows {
+				if v != nil {
+					present++
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\t%s\n", s.ID, s.Created.Format("2006-01-02 15:04:05"), s.Reason, present, len(s.Rows), s.DBPath)
+		}
+		return w.Flush()
+	},
+}
+
+var dbRestoreCmd = &cobra.Command{
+	Use:   "restore <id>",
+	Short: "Write a snapshot's credential rows back into the IDE database",
+	Long: `Write a snapshot's credential rows back into the IDE database. The current
+rows are snapshotted first, so a restore can itself be undone.
+
+Close the IDE first, it keeps its own copy of these values and overwrites them on exit.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		snap, err := injection.LoadSnapshot(args[0])
+		if err != nil {
+			return err
+		}
+
+		dbPath := restoreDBPath
+		if dbPath == "" {
+			dbPath = snap.DBPath
+		}
+		if dbPath == "" {
+			dbPath = utils.GetAntigravityDBPath()
+		}
+
+		err = injection.WithSnapshot(dbPath, "before restore of "+snap.ID, func() error {
+			return snap.Restore(dbPath)
+		})
+		if err != nil {
+			return fmt.Errorf("restore failed: %v", err)
+		}
+
+		fmt.Printf("✓ Restored snapshot %s (%s) into %s\n", snap.ID, snap.Reason, dbPath)
+		return nil
+	},
+}
+
+var dbInspectCmd = &cobra.Command{
+	Use:   "inspect <key>",
+	Short: "Decode a base64 protobuf value from ItemTable without a schema",
+	Long: `Decode a base64 protobuf value, such as jetskiStateSync.agentManagerInitState,
+and print its fields as a tree: field numbers, wire types, guessed strings,
+nested messages and timestamps.
+
+--json prints the same tree as JSON, handy for diffing two IDE versions.
+Values hold live tokens, don't paste the output anywhere public.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dbPath := inspectDBPath
+		if dbPath == "" {
+			dbPath = utils.GetAntigravityDBPath()
+		}
+
+		value, ok, err := injection.ReadItem(dbPath, args[0])
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("key '%s' not found in %s", args[0], dbPath)
+		}
+		data, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return fmt.Errorf("value of '%s' is not base64, it is stored as plain text: %s", args[0], value)
+		}
+
+		// A parse error still leaves the fields decoded before it
+		fields, decodeErr := injection.DecodeMessage(data)
+
+		if inspectJSON {
+			out := struct {
+				Key    string                 `json:"key"`
+				Size   int                    `json:"size"`
+				Fields []injection.ProtoField `json:"fields"`
+				Error  string                 `json:"error,omitempty"`
+			}{Key: args[0], Size: len(data), Fields: fields}
+			if decodeErr != nil {
+				out.Error = decodeErr.Error()
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(out)
+		}
+
+		fmt.Printf("%s (%d bytes)\n", args[0], len(data))
+		fmt.Print(injection.FormatFields(fields))
+		if decodeErr != nil {
+			fmt.Printf("⚠️ Decoding stopped: %v\n", decodeErr)
+		}
+		return nil
+	},
+}
+
+var dbVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that the IDE database holds a profile's identity",
+	Long: `Re-read antigravityAuthStatus and agentManagerInitState and compare the
+email, access token, refresh token and expiry with a profile (default: the
+active one). Exits with an error when anything differs.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profileName := verifyProfile
+		if profileName == "" {
+			profileName = config.GetActiveProfileName()
+		}
+		if profileName == "" {
+			return fmt.Errorf("no active profile, name one with --profile")
+		}
+
+		store, err := getStore()
+		if err != nil {
+			return fmt.Errorf("error loading store: %v", err)
+		}
+		profile, ok := store.GetProfile(profileName)
+		if !ok {
+			return fmt.Errorf("profile '%s' not found", profileName)
+		}
+
+		dbPath := verifyDBPath
+		if dbPath == "" {
+			dbPath = utils.GetAntigravityDBPath()
+		}
+
+		err = injection.VerifyIdentity(dbPath, session.IdentityFromProfile(profile))
+		var verifyErr *injection.VerifyError
+		if errors.As(err, &verifyErr) {
+			fmt.Printf("❌ %s does not match profile '%s':\n", dbPath, profileName)
+			for _, m := range verifyErr.Mismatches {
+				fmt.Printf("   %s: want %s, got %s\n", m.Field, m.Want, m.Got)
+			}
+			return fmt.Errorf("verification failed")
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("✓ %s holds profile '%s' (%s)\n", dbPath, profileName, profile.Email)
+		return nil
+	},
+}
+
+func init() {
+	dbVerifyCmd.Flags().StringVar(&verifyDBPath, "db", "", "Database to check (default: the IDE's state.vscdb)")
+	dbVerifyCmd.Flags().StringVar(&verifyProfile, "profile", "", "Profile to compare with (default: the active profile)")
+	dbInspectCmd.Flags().StringVar(&inspectDBPath, "db", "", "Database to read (default: the IDE's state.vscdb)")
+	dbInspectCmd.Flags().BoolVar(&inspectJSON, "json", false, "Print the decoded tree as JSON")
+	dbRestoreCmd.Flags().StringVar(&restoreDBPath, "db", "", "Database to restore into (default: the one the snapshot was taken from)")
+
+	dbBackupCmd.AddCommand(dbBackupListCmd)
+	dbCmd.AddCommand(dbBackupCmd)
+	dbCmd.AddCommand(dbRestoreCmd)
+	dbCmd.AddCommand(dbInspectCmd)
+	dbCmd.AddCommand(dbVerifyCmd)
+	rootCmd.AddCommand(dbCmd)
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+
+	"antigravity-cli/internal/injection"
+	"antigravity-cli/internal/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var ideCmd = &cobra.Command{
+	Use:   "ide",
+	Short: "Act on the Antigravity IDE's sign-in state",
+}
+
+var ideLogoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Sign the IDE out, like its own Sign Out button",
+	Long: `Sign the IDE out by clearing the credential rows of its database. The rows
+are snapshotted first, see 'antigravity db backup list' and 'db restore'.
+
+Stored profiles and their Google grants are untouched; to revoke a profile's
+grant use 'antigravity logout <profile>'.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		kill, _ := cmd.Flags().GetBool("kill")
+		if kill {
+			fmt.Println("Killing Antigravity process...")
+			utils.KillAntigravity()
+		}
+
+		dbPath := utils.GetAntigravityDBPath()
+		fmt.Printf("Signing out of %s...\n", dbPath)
+		if err := reportChanges(dbPath, func() error { return injection.ClearIdentity(dbPath) }); err != nil {
+			return fmt.Errorf("sign out failed: %v", err)
+		}
+		fmt.Println("✓ IDE signed out")
+		return nil
+	},
+}
+
+// reportChanges runs mutate and prints which credential rows it changed
+func reportChanges(dbPath string, mutate func() error) error {
+	before, err := injection.ReadCredentialRows(dbPath)
+	if err != nil {
+		return err
+	}
+	if err := mutate(); err != nil {
+		return err
+	}
+	after, err := injection.ReadCredentialRows(dbPath)
+	if err != nil {
+		return err
+	}
+
+	changes := injection.DiffRows(before, after)
+	if len(changes) == 0 {
+		fmt.Println("No keys changed.")
+		return nil
+	}
+	symbols := map[string]string{"added": "+", "deleted": "-", "modified": "~"}
+	fmt.Println("Changed keys (undo with 'antigravity db backup list' / 'db restore'):")
+	for _, c := range changes {
+		fmt.Printf("  %s %s (%s)\n", symbols[c.Change], c.Key, c.Change)
+	}
+	return nil
+}
+
+func init() {
+	ideLogoutCmd.Flags().BoolP("kill", "k", false, "Kill Antigravity process first, it rewrites its credentials on exit")
+
+	ideCmd.AddCommand(ideLogoutCmd)
+	rootCmd.AddCommand(ideCmd)
+}
@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"antigravity-cli/internal/config"
 	"antigravity-cli/internal/injection"
+	"antigravity-cli/internal/session"
 	"antigravity-cli/internal/utils"
 	"fmt"
 	"time"
@@ -12,42 +14,134 @@ import (
 var injectCmd = &cobra.Command{
 	Use:   "inject",
 	Short: "Inject a cloud token into Antigravity IDE",
+	Long: `Sign the IDE in by writing tokens into its database.
+
+--profile uses a stored profile's tokens, refreshing them first when they
+expire within 5 minutes. --token/--refresh take raw tokens instead; they end
+up in your shell history, prefer --profile.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		email, _ := cmd.Flags().GetString("email")
-		name, _ := cmd.Flags().GetString("name")
-		accessToken, _ := cmd.Flags().GetString("token")
-		refreshToken, _ := cmd.Flags().GetString("refresh")
+		profileName, _ := cmd.Flags().GetString("profile")
 		kill, _ := cmd.Flags().GetBool("kill")
+		replace, _ := cmd.Flags().GetBool("replace")
 
-		if accessToken == "" {
-			return fmt.Errorf("access token is required")
+		mode, err := injection.ParseInjectMode(config.Current().IDE.InjectMode)
+		if err != nil {
+			return err
 		}
+		if replace {
+			mode = injection.ModeReplace
+		}
+
+		var identity injection.Identity
+		if profileName != "" {
+			for _, flag := range []string{"token", "refresh", "expiry", "email", "name", "avatar-url"} {
+				if cmd.Flags().Changed(flag) {
+					return fmt.Errorf("--%s cannot be combined with --profile", flag)
+				}
+			}
+			profile, err := loadProfileForInjection(profileName)
+			if err != nil {
+				return err
+			}
+			identity = session.IdentityFromProfile(profile)
+		} else {
+			email, _ := cmd.Flags().GetString("email")
+			name, _ := cmd.Flags().GetString("name")
+			accessToken, _ := cmd.Flags().GetString("token")
+			refreshToken, _ := cmd.Flags().GetString("refresh")
+			avatarURL, _ := cmd.Flags().GetString("avatar-url")
+			expiry, _ := cmd.Flags().GetInt64("expiry")
+
+			if accessToken == "" {
+				return fmt.Errorf("access token is required (or use --profile)")
+			}
+			identity = injection.Identity{
+				AccessToken:  accessToken,
+				RefreshToken: refreshToken,
+				Email:        email,
+				Name:         name,
+				AvatarURL:    avatarURL,
+				Expiry:       injection.UnixExpiry(expiry),
+			}
+		}
+		identity.Mode = mode
 
 		if kill {
 			fmt.Println("Killing Antigravity process...")
-			utils.KillAntigravity()
-			time.Sleep(1 * time.Second)
+			utils.KillAntigravity() // a DB still held while it exits is retried
 		}
 
 		dbPath := utils.GetAntigravityDBPath()
-		fmt.Printf("Injecting token for %s into %s...\n", email, dbPath)
-		
-		err := injection.InjectIdentity(dbPath, accessToken, refreshToken, email, name)
+		fmt.Printf("Injecting token for %s into %s...\n", identity.Email, dbPath)
+
+		err = reportChanges(dbPath, func() error {
+			return injection.InjectIdentity(dbPath, identity)
+		})
 		if err != nil {
 			return fmt.Errorf("injection failed: %v", err)
 		}
+		if err := injection.VerifyIdentity(dbPath, identity); err != nil {
+			return fmt.Errorf("injection verification failed: %v", err)
+		}
 
 		fmt.Println("Successfully injected cloud token!")
 		return nil
 	},
 }
 
+// loadProfileForInjection returns a stored profile with usable tokens,
+// refreshing the access token through the profile's proxy when it expires
+// within 5 minutes
+func loadProfileForInjection(profileName string) (config.Profile, error) {
+	store, err := getStore()
+	if err != nil {
+		return config.Profile{}, fmt.Errorf("error loading store: %v", err)
+	}
+	profile, ok := store.GetProfile(profileName)
+	if !ok {
+		return config.Profile{}, fmt.Errorf("profile '%s' not found", profileName)
+	}
+	if state, err := profile.Secrets(); state == config.SecretsLocked || state == config.SecretsCorrupted {
+		return config.Profile{}, fmt.Errorf("tokens of '%s' are %s: %v", profileName, state, err)
+	}
+	if !hasTokens(profile) {
+		return config.Profile{}, fmt.Errorf("profile '%s' has no tokens, run 'antigravity login %s' first", profileName, profileName)
+	}
+
+	if profile.ExpiryTimestamp >= time.Now().Unix()+5*60 {
+		return profile, nil
+	}
+
+	fmt.Println("🔄 Token expired or expiring soon, refreshing...")
+	t, err := openTunnel(profile)
+	if err != nil {
+		fmt.Printf("⚠️ Token refresh failed, injecting the stored token: %v\n", err)
+		return profile, nil
+	}
+	defer t.Close()
+
+	tokenResp, err := refreshTokens(profile.RefreshToken, t.Port)
+	if err != nil {
+		fmt.Printf("⚠️ Token refresh failed, injecting the stored token: %v\n", err)
+		return profile, nil
+	}
+	if err := session.SaveRefreshedTokens(store, &profile, tokenResp); err != nil {
+		fmt.Printf("⚠️ Failed to save refreshed token: %v\n", err)
+	} else {
+		fmt.Println("✅ Token refreshed!")
+	}
+	return profile, nil
+}
+
 func init() {
 	rootCmd.AddCommand(injectCmd)
+	injectCmd.Flags().StringP("profile", "p", "", "Inject a stored profile's tokens")
 	injectCmd.Flags().StringP("email", "e", "", "Email address (informational)")
 	injectCmd.Flags().StringP("name", "n", "", "Display name")
-	injectCmd.Flags().StringP("token", "t", "", "Access Token (required)")
+	injectCmd.Flags().StringP("token", "t", "", "Access Token (required without --profile)")
 	injectCmd.Flags().StringP("refresh", "r", "", "Refresh Token")
-	injectCmd.Flags().Int64("expiry", 0, "Expiry timestamp (seconds) - Ignored in this version")
+	injectCmd.Flags().String("avatar-url", "", "Profile picture URL")
+	injectCmd.Flags().Int64("expiry", 0, "Access token expiry as a Unix timestamp (default: now + 24h)")
+	injectCmd.Flags().Bool("replace", false, "Overwrite agentManagerInitState instead of merging the new tokens into it")
 	injectCmd.Flags().BoolP("kill", "k", false, "Kill Antigravity process before injection")
-}
\ No newline at end of file
+}
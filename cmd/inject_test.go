@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"antigravity-cli/internal/auth"
+	"antigravity-cli/internal/config"
+)
+
+func TestLoadProfileForInjection_SavesRotatedRefreshToken(t *testing.T) {
+	setupTestStore(t, config.Profile{Name: "alice", Email: "alice@example.com", AccessToken: "stale", RefreshToken: "refresh"})
+	stubTunnel(t)
+	old := refreshTokens
+	refreshTokens = func(refreshToken string, port int) (*auth.TokenResponse, error) {
+		return &auth.TokenResponse{AccessToken: "fresh-access", RefreshToken: "rotated", ExpiresIn: 3600}, nil
+	}
+	t.Cleanup(func() { refreshTokens = old })
+
+	p, err := loadProfileForInjection("alice")
+	if err != nil {
+		t.Fatalf("loadProfileForInjection failed: %v", err)
+	}
+	if p.AccessToken != "fresh-access" || p.RefreshToken != "rotated" {
+		t.Errorf("refreshed tokens not injected: %+v", p)
+	}
+	saved, _ := reloadProfile(t, "alice")
+	if saved.AccessToken != "fresh-access" || saved.RefreshToken != "rotated" || saved.ExpiryTimestamp < time.Now().Unix() {
+		t.Errorf("refreshed tokens not saved: %+v", saved)
+	}
+}
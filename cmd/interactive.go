@@ -43,7 +43,7 @@ func init() {
 	}
 	debugLogger = log.New(f, "TUI: ", log.LstdFlags)
 	debugLogger.Printf("---- Session Started ----")
-	fmt.Printf("Debug log: %s\n", logPath)
+	fmt.Fprintf(os.Stderr, "Debug log: %s\n", logPath) // stderr keeps --json output clean
 }
 
 // waitUser делает надежную паузу
@@ -121,14 +121,8 @@ type menuItem struct {
 }
 
 func handleSelectAccount() {
-	homeDir, err := os.UserHomeDir()
+	store, err := getStore()
 	if err != nil {
-		log.Printf("Error getting home dir: %v", err)
-		waitUser()
-		return
-	}
-	store := config.NewStore(filepath.Join(homeDir, ".antigravity-cli", "profiles.json"))
-	if err := store.Load(); err != nil {
 		log.Printf("Error loading profiles: %v", err)
 		waitUser()
 		return
@@ -167,6 +161,8 @@ Go back to main menu
 {{ else }}
 {{ "Name:" | faint }}	{{ .Profile.Name }}
 {{ "Email:" | faint }}	{{ .Profile.Email }}
+{{ "Account:" | faint }}	{{ if .Profile.DisplayName }}{{ .Profile.DisplayName }}{{ else }}(not logged in){{ end }}
+{{ "Avatar:" | faint }}	{{ if .Profile.AvatarURL }}{{ .Profile.AvatarURL }}{{ else }}-{{ end }}
 {{ "Proxy:" | faint }}	{{ .Profile.ProxyHost }}:{{ .Profile.ProxyPort }}
 {{ "Tunnel:" | faint }}	{{ .Profile.UseSystemTunnel }}
 {{ end }}
@@ -201,7 +197,7 @@ Go back to main menu
 func handleProfileActions(profile config.Profile, store *config.Store) {
 	prompt := promptui.Select{
 		Label: "Action",
-		Items: []string{"Connect", "Login", "Delete", "Back"},
+		Items: []string{"Connect", "Login", "Edit", "Delete", "Back"},
 		Stdout: &BellSkipper{},
 	}
 
@@ -237,15 +233,39 @@ func handleProfileActions(profile config.Profile, store *config.Store) {
 		}
 		waitUser()
 
+	case "Edit":
+		handleEditProfile(profile, store)
+		waitUser()
+
 	case "Delete":
 		confirmPrompt := promptui.Prompt{
 			Label:     fmt.Sprintf("Are you sure you want to delete profile '%s'", profile.Name),
 			IsConfirm: true,
 		}
 		_, err := confirmPrompt.Run()
+		if err == nil && hasTokens(profile) {
+			revokePrompt := promptui.Select{
+				Label:  "Revoke tokens at Google before deleting?",
+				Items:  []string{"Yes", "No"},
+				Stdout: &BellSkipper{},
+			}
+			_, revokeRes, perr := revokePrompt.Run()
+			if perr != nil {
+				return
+			}
+			if revokeRes == "Yes" {
+				if rerr := revokeProfileTokens(profile); rerr != nil {
+					fmt.Printf("\n❌ Revocation failed: %v\n", rerr)
+					forcePrompt := promptui.Prompt{
+						Label:     "Delete locally anyway (the grant stays valid at Google)",
+						IsConfirm: true,
+					}
+					_, err = forcePrompt.Run()
+				}
+			}
+		}
 		if err == nil {
-			delete(store.Profiles, profile.Name)
-			if err := store.Save(); err != nil {
+			if err := store.RemoveProfile(profile.Name); err != nil {
 				fmt.Printf("Error deleting profile: %v\n", err)
 			} else {
 				fmt.Println("Profile deleted.")
@@ -258,6 +278,139 @@ func handleProfileActions(profile config.Profile, store *config.Store) {
 	}
 }
 
+// handleEditProfile walks through the profile's settings with the current
+// values pre-filled and saves the changes
+func handleEditProfile(profile config.Profile, store *config.Store) {
+	edited := profile
+
+	namePrompt := promptui.Prompt{
+		Label:     "Profile Name",
+		Default:   profile.Name,
+		AllowEdit: true,
+		Validate: func(input string) error {
+			if len(input) == 0 { return errors.New("name cannot be empty") }
+			return nil
+		},
+	}
+	newName, err := namePrompt.Run()
+	if err != nil { return }
+
+	emailPrompt := promptui.Prompt{
+		Label:     "Google Email",
+		Default:   profile.Email,
+		AllowEdit: true,
+	}
+	edited.Email, err = emailPrompt.Run()
+	if err != nil { return }
+
+	proxyTypes := []string{"socks5", "http", "none"}
+	cursor := 0
+	if profile.ProxyHost == "" {
+		cursor = 2
+	} else if profile.ProxyScheme == "http" {
+		cursor = 1
+	}
+	proxyTypePrompt := promptui.Select{
+		Label:     "Proxy Type",
+		Items:     proxyTypes,
+		CursorPos: cursor,
+		Stdout:    &BellSkipper{},
+	}
+	_, proxyType, err := proxyTypePrompt.Run()
+	if err != nil { return }
+
+	if proxyType == "none" {
+		edited.ProxyScheme, edited.ProxyHost, edited.ProxyPort = "", "", 0
+		edited.ProxyUser, edited.ProxyPass = "", ""
+	} else {
+		edited.ProxyScheme = proxyType
+
+		proxyHostPrompt := promptui.Prompt{
+			Label:     "Proxy Host",
+			Default:   profile.ProxyHost,
+			AllowEdit: true,
+			Validate: func(input string) error {
+				if len(input) == 0 { return errors.New("host cannot be empty") }
+				return nil
+			},
+		}
+		edited.ProxyHost, err = proxyHostPrompt.Run()
+		if err != nil { return }
+
+		proxyPortPrompt := promptui.Prompt{
+			Label:     "Proxy Port",
+			Default:   strconv.Itoa(profile.ProxyPort),
+			AllowEdit: true,
+			Validate: func(input string) error {
+				port, err := strconv.Atoi(input)
+				if err != nil || port < 1 || port > 65535 { return errors.New("invalid port number") }
+				return nil
+			},
+		}
+		proxyPortStr, err := proxyPortPrompt.Run()
+		if err != nil { return }
+		edited.ProxyPort, _ = strconv.Atoi(proxyPortStr)
+
+		proxyUserPrompt := promptui.Prompt{
+			Label:     "Proxy User",
+			Default:   profile.ProxyUser,
+			AllowEdit: true,
+		}
+		edited.ProxyUser, err = proxyUserPrompt.Run()
+		if err != nil { return }
+
+		proxyPassPrompt := promptui.Prompt{
+			Label: "Proxy Password (empty keeps the current one)",
+			Mask:  '*',
+		}
+		proxyPass, err := proxyPassPrompt.Run()
+		if err != nil { return }
+		if proxyPass != "" {
+			edited.ProxyPass = proxyPass
+		}
+	}
+
+	sysTunnelCursor := 1
+	if profile.UseSystemTunnel {
+		sysTunnelCursor = 0
+	}
+	sysTunnelPrompt := promptui.Select{
+		Label:     "Use System Tunnel?",
+		Items:     []string{"Yes", "No"},
+		CursorPos: sysTunnelCursor,
+		Stdout:    &BellSkipper{},
+	}
+	_, sysTunnelRes, err := sysTunnelPrompt.Run()
+	if err != nil { return }
+	edited.UseSystemTunnel = (sysTunnelRes == "Yes")
+
+	if err := validateProfile(edited); err != nil {
+		fmt.Printf("\n❌ %v\n", err)
+		return
+	}
+
+	// Apply only the edited settings to the freshest copy, tokens may have been refreshed meanwhile
+	err = store.Update(profile.Name, func(p *config.Profile) error {
+		p.Email = edited.Email
+		p.ProxyScheme, p.ProxyHost, p.ProxyPort = edited.ProxyScheme, edited.ProxyHost, edited.ProxyPort
+		p.ProxyUser, p.ProxyPass = edited.ProxyUser, edited.ProxyPass
+		p.UseSystemTunnel = edited.UseSystemTunnel
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("\n❌ Failed to save profile: %v\n", err)
+		return
+	}
+
+	if newName != profile.Name {
+		if err := store.RenameProfile(profile.Name, newName); err != nil {
+			fmt.Printf("\n❌ Settings saved, but rename failed: %v\n", err)
+			return
+		}
+	}
+	fmt.Println("Profile saved successfully!")
+}
+
 func handleAddAccount() {
 	// Wizard
 	proxyTypePrompt := promptui.Select{
@@ -342,10 +495,13 @@ func handleAddAccount() {
 		ExpiryTimestamp: 0,
 	}
 
-	homeDir, _ := os.UserHomeDir()
-	store := config.NewStore(filepath.Join(homeDir, ".antigravity-cli", "profiles.json"))
-	store.Load()
-	
+	store, err := getStore()
+	if err != nil {
+		fmt.Printf("Failed to load profiles: %v\n", err)
+		waitUser()
+		return
+	}
+
 	if err := store.AddProfile(newProfile); err != nil {
 		fmt.Printf("Failed to save profile: %v\n", err)
 	} else {
@@ -480,6 +636,8 @@ Cancel and go back
 {{ else }}
 {{ "Name:" | faint }}	{{ .Profile.Name }}
 {{ "Email:" | faint }}	{{ .Profile.Email }}
+{{ "Account:" | faint }}	{{ if .Profile.DisplayName }}{{ .Profile.DisplayName }}{{ else }}(not logged in){{ end }}
+{{ "Avatar:" | faint }}	{{ if .Profile.AvatarURL }}{{ .Profile.AvatarURL }}{{ else }}-{{ end }}
 {{ "Proxy:" | faint }}	{{ .Profile.ProxyHost }}:{{ .Profile.ProxyPort }}
 {{ end }}
 -----------------------------------`,
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"antigravity-cli/internal/auth"
+	"antigravity-cli/internal/config"
 
 	"github.com/spf13/cobra"
 )
@@ -113,15 +114,26 @@ func runLogin(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("error exchanging code: %v", err)
 	}
 
-	// Get user info to verify email
+	// Get user info to verify the account before saving anything
 	userInfo, err := auth.GetUserInfo(tokenResp.AccessToken)
 	if err != nil {
+		if loginStrict {
+			return fmt.Errorf("could not verify the authenticated account, tokens NOT saved: %v", err)
+		}
 		fmt.Printf("Warning: Could not verify user email: %v\n", err)
 	} else {
-		if !strings.EqualFold(userInfo.Email, profile.Email) {
-			fmt.Printf("Warning: Authenticated email (%s) does not match profile email (%s)\n", userInfo.Email, profile.Email)
-		} else {
-			fmt.Printf("Email verified: %s\n", userInfo.Email)
+		profile, err = bindAccount(store, profile, userInfo)
+		if err != nil {
+			return err
+		}
+		profileName = profile.Name
+
+		// Keep the account identity up to date for injection and the TUI
+		profile.GoogleID = userInfo.ID
+		profile.DisplayName = userInfo.Name
+		profile.AvatarURL = userInfo.Picture
+		if userInfo.Name != "" {
+			fmt.Printf("Signed in as: %s\n", userInfo.Name)
 		}
 	}
 
@@ -132,17 +144,96 @@ func runLogin(cmd *cobra.Command, args []string) error {
 	profile.AccessToken = tokenResp.AccessToken
 	profile.RefreshToken = tokenResp.RefreshToken
 	profile.ExpiryTimestamp = expiryTimestamp
+	profile.RevokedAt = 0
 
-	// Save the updated profile
-	store.Profiles[profileName] = profile
-	if err := store.Save(); err != nil {
+	// Save the updated profile. Only the login-owned fields are written, anything
+	// else (e.g. proxy settings) may have been changed by another process meanwhile.
+	if profileName != args[0] {
+		err = store.AddProfile(profile)
+	} else {
+		err = store.Update(profileName, func(p *config.Profile) error {
+			p.Email = profile.Email
+			p.GoogleID = profile.GoogleID
+			p.DisplayName = profile.DisplayName
+			p.AvatarURL = profile.AvatarURL
+			p.AccessToken = profile.AccessToken
+			p.RefreshToken = profile.RefreshToken
+			p.ExpiryTimestamp = profile.ExpiryTimestamp
+			p.RevokedAt = 0
+			return nil
+		})
+	}
+	if err != nil {
 		return fmt.Errorf("error saving tokens: %v", err)
 	}
 
-	fmt.Println("\n✓ Login successful! Tokens have been saved and encrypted.")
+	fmt.Printf("\n✓ Login successful! Tokens have been saved and encrypted to profile '%s'.\n", profileName)
 	return nil
 }
 
+// bindAccount checks that the authenticated Google account belongs to the profile.
+// The Google user ID is authoritative once recorded; before that the email is compared.
+// On a mismatch the login is rejected unless --update-email or --new-profile says
+// what to do, in which case the profile to save the tokens into is returned.
+func bindAccount(store *config.Store, profile config.Profile, userInfo *auth.UserInfo) (config.Profile, error) {
+	idMatches := profile.GoogleID == "" || profile.GoogleID == userInfo.ID
+	emailMatches := strings.EqualFold(userInfo.Email, profile.Email)
+
+	switch {
+	case profile.GoogleID != "" && profile.GoogleID == userInfo.ID:
+		if !emailMatches {
+			// Same Google account, its address changed
+			fmt.Printf("Account email changed: %s -> %s\n", profile.Email, userInfo.Email)
+			profile.Email = userInfo.Email
+		} else {
+			fmt.Printf("Account verified: %s\n", userInfo.Email)
+		}
+		return profile, nil
+	case idMatches && emailMatches:
+		fmt.Printf("Email verified: %s\n", userInfo.Email)
+		return profile, nil
+	}
+
+	if loginUpdateEmail {
+		fmt.Printf("Rebinding profile '%s': %s -> %s\n", profile.Name, profile.Email, userInfo.Email)
+		profile.Email = userInfo.Email
+		return profile, nil
+	}
+
+	if loginNewProfile != "" {
+		if _, exists := store.GetProfile(loginNewProfile); exists {
+			return profile, fmt.Errorf("profile '%s' already exists, tokens NOT saved", loginNewProfile)
+		}
+		fmt.Printf("Creating profile '%s' for %s (proxy settings copied from '%s')\n", loginNewProfile, userInfo.Email, profile.Name)
+		// Only the settings, not the source's data key or sealed hash: the new
+		// profile gets a data key of its own when it is saved
+		newProfile := config.Profile{
+			Name:            loginNewProfile,
+			Email:           userInfo.Email,
+			ProxyScheme:     profile.ProxyScheme,
+			ProxyHost:       profile.ProxyHost,
+			ProxyPort:       profile.ProxyPort,
+			ProxyUser:       profile.ProxyUser,
+			ProxyPass:       profile.ProxyPass,
+			UseSystemTunnel: profile.UseSystemTunnel,
+		}
+		return newProfile, nil
+	}
+
+	if !loginStrict {
+		fmt.Printf("Warning: Authenticated account (%s) does not match profile '%s' (%s)\n", userInfo.Email, profile.Name, profile.Email)
+		return profile, nil
+	}
+
+	bound := profile.Email
+	if emailMatches {
+		bound = fmt.Sprintf("a different Google account with the same email (ID %s)", profile.GoogleID)
+	}
+	return profile, fmt.Errorf("authenticated as %s, but profile '%s' is bound to %s. Tokens NOT saved.\n"+
+		"Re-run with --update-email to rebind this profile, or --new-profile <name> to save this account separately",
+		userInfo.Email, profile.Name, bound)
+}
+
 func openBrowser(url string) error {
 	var cmd *exec.Cmd
 
@@ -166,6 +257,14 @@ func shutdownServer(server *http.Server) {
 	server.Shutdown(ctx)
 }
 
+var (
+	loginStrict      bool
+	loginUpdateEmail bool
+	loginNewProfile  string
+)
+
 func init() {
-	// No additional flags needed for login command
+	loginCmd.Flags().BoolVar(&loginStrict, "strict", true, "Reject logins whose Google account does not match the profile")
+	loginCmd.Flags().BoolVar(&loginUpdateEmail, "update-email", false, "On mismatch, rebind the profile to the authenticated account")
+	loginCmd.Flags().StringVar(&loginNewProfile, "new-profile", "", "On mismatch, save the account into a new profile with this name")
 }
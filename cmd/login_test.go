@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"antigravity-cli/internal/auth"
+	"antigravity-cli/internal/config"
+)
+
+// setLoginFlags sets the mismatch flags of 'login' for one test
+func setLoginFlags(t *testing.T, strict, updateEmail bool, newProfile string) {
+	t.Helper()
+	loginStrict, loginUpdateEmail, loginNewProfile = strict, updateEmail, newProfile
+	t.Cleanup(func() { loginStrict, loginUpdateEmail, loginNewProfile = true, false, "" })
+}
+
+func TestBindAccount(t *testing.T) {
+	store := setupTestStore(t, config.Profile{Name: "taken", Email: "taken@example.com"})
+	profile := config.Profile{Name: "work", Email: "work@example.com", GoogleID: "111"}
+
+	tests := []struct {
+		name        string
+		strict      bool
+		updateEmail bool
+		newProfile  string
+		userInfo    auth.UserInfo
+		wantErr     bool
+		wantName    string
+		wantEmail   string
+	}{
+		{name: "match", strict: true, userInfo: auth.UserInfo{ID: "111", Email: "work@example.com"}, wantName: "work", wantEmail: "work@example.com"},
+		{name: "same account, new address", strict: true, userInfo: auth.UserInfo{ID: "111", Email: "renamed@example.com"}, wantName: "work", wantEmail: "renamed@example.com"},
+		{name: "other account", strict: true, userInfo: auth.UserInfo{ID: "222", Email: "other@example.com"}, wantErr: true},
+		{name: "other account, same address", strict: true, userInfo: auth.UserInfo{ID: "222", Email: "work@example.com"}, wantErr: true},
+		{name: "--update-email", strict: true, updateEmail: true, userInfo: auth.UserInfo{ID: "222", Email: "other@example.com"}, wantName: "work", wantEmail: "other@example.com"},
+		{name: "--new-profile", strict: true, newProfile: "other", userInfo: auth.UserInfo{ID: "222", Email: "other@example.com"}, wantName: "other", wantEmail: "other@example.com"},
+		{name: "--new-profile taken", strict: true, newProfile: "taken", userInfo: auth.UserInfo{ID: "222", Email: "other@example.com"}, wantErr: true},
+		{name: "--strict=false", userInfo: auth.UserInfo{ID: "222", Email: "other@example.com"}, wantName: "work", wantEmail: "work@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setLoginFlags(t, tt.strict, tt.updateEmail, tt.newProfile)
+
+			got, err := bindAccount(store, profile, &tt.userInfo)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected the login to be rejected, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("bindAccount failed: %v", err)
+			}
+			if got.Name != tt.wantName || got.Email != tt.wantEmail {
+				t.Errorf("got %s <%s>, want %s <%s>", got.Name, got.Email, tt.wantName, tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestBindAccount_UnboundProfileComparesEmail(t *testing.T) {
+	store := setupTestStore(t)
+	setLoginFlags(t, true, false, "")
+	profile := config.Profile{Name: "fresh", Email: "Fresh@Example.com"}
+
+	if _, err := bindAccount(store, profile, &auth.UserInfo{ID: "333", Email: "fresh@example.com"}); err != nil {
+		t.Errorf("email match should be case-insensitive: %v", err)
+	}
+	if _, err := bindAccount(store, profile, &auth.UserInfo{ID: "333", Email: "someone@example.com"}); err == nil {
+		t.Error("expected an email mismatch to be rejected")
+	}
+}
+
+func TestBindAccount_NewProfileGetsItsOwnDataKey(t *testing.T) {
+	store := setupTestStore(t, config.Profile{Name: "work", Email: "work@example.com", GoogleID: "111", ProxyHost: "proxy", ProxyPort: 1080, ProxyUser: "u", AccessToken: "a"})
+	setLoginFlags(t, true, false, "other")
+	work, _ := store.GetProfile("work")
+
+	other, err := bindAccount(store, work, &auth.UserInfo{ID: "222", Email: "other@example.com"})
+	if err != nil {
+		t.Fatalf("bindAccount failed: %v", err)
+	}
+	if other.ID != "" || other.GoogleID != "" || other.WrappedKey != nil || other.KeyID != "" || other.EncryptedBlob != nil {
+		t.Errorf("source profile's identity or keys copied: %+v", other)
+	}
+	if other.ProxyHost != "proxy" || other.ProxyPort != 1080 || other.ProxyUser != "u" {
+		t.Errorf("proxy settings not copied: %+v", other)
+	}
+
+	other.AccessToken = "b"
+	if err := store.AddProfile(other); err != nil {
+		t.Fatalf("AddProfile failed: %v", err)
+	}
+	saved, _ := reloadProfile(t, "other")
+	if saved.AccessToken != "b" || bytes.Equal(saved.WrappedKey, work.WrappedKey) {
+		t.Errorf("new profile not sealed with its own data key: %+v", saved)
+	}
+}
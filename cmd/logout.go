@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"antigravity-cli/internal/auth"
+	"antigravity-cli/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout [profile_name]",
+	Short: "Revoke a profile's Google grant and wipe its tokens",
+	Long: `Revoke the profile's refresh token at Google (through the profile's proxy),
+then wipe the encrypted tokens from the store. The profile itself is kept,
+run 'antigravity login' to authenticate it again.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profileName := args[0]
+
+		store, err := getStore()
+		if err != nil {
+			return fmt.Errorf("error loading store: %v", err)
+		}
+
+		profile, exists := store.GetProfile(profileName)
+		if !exists {
+			return fmt.Errorf("profile '%s' not found", profileName)
+		}
+
+		if err := revokeProfileTokens(profile); err != nil {
+			return fmt.Errorf("revocation failed, tokens were NOT wiped and the grant is still valid at Google: %v", err)
+		}
+
+		err = store.Update(profileName, func(p *config.Profile) error {
+			p.AccessToken = ""
+			p.RefreshToken = ""
+			p.ExpiryTimestamp = 0
+			p.RevokedAt = time.Now().Unix()
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("grant revoked, but failed to wipe local tokens: %v", err)
+		}
+
+		fmt.Printf("✓ Logged out '%s'. Tokens revoked and wiped.\n", profileName)
+		return nil
+	},
+}
+
+// hasTokens reports whether the profile holds real (not placeholder) tokens
+func hasTokens(p config.Profile) bool {
+	return (p.RefreshToken != "" && p.RefreshToken != "pending_auth") ||
+		(p.AccessToken != "" && p.AccessToken != "pending_auth")
+}
+
+// revokeProfileTokens revokes the profile's grant at Google through the profile's own proxy.
+// A token Google already considers invalid counts as revoked.
+func revokeProfileTokens(profile config.Profile) error {
+	if !hasTokens(profile) {
+		fmt.Println("Profile has no tokens, nothing to revoke.")
+		return nil
+	}
+
+	// Revoking the refresh token kills the whole grant; fall back to the access token
+	token := profile.RefreshToken
+	if token == "" || token == "pending_auth" {
+		token = profile.AccessToken
+	}
+
+	fmt.Printf("Opening tunnel for '%s'...\n", profile.Name)
+	t, err := openTunnel(profile)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	fmt.Println("Revoking tokens at Google...")
+	err = revokeToken(token, t.Port)
+	if errors.Is(err, auth.ErrInvalidToken) {
+		fmt.Println("ℹ️ Google reports the token as already invalid.")
+		return nil
+	}
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(logoutCmd)
+}
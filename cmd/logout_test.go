@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"antigravity-cli/internal/auth"
+	"antigravity-cli/internal/config"
+)
+
+// stubRevoke answers revocation requests with err and records the tokens
+func stubRevoke(t *testing.T, err error) *[]string {
+	t.Helper()
+	stubTunnel(t)
+	var revoked []string
+	old := revokeToken
+	revokeToken = func(token string, port int) error {
+		revoked = append(revoked, token)
+		return err
+	}
+	t.Cleanup(func() { revokeToken = old })
+	return &revoked
+}
+
+func loggedInProfile(name string) config.Profile {
+	return config.Profile{Name: name, Email: name + "@example.com", AccessToken: "access", RefreshToken: "refresh", ExpiryTimestamp: 42}
+}
+
+func TestLogout_RevokesThenWipes(t *testing.T) {
+	for _, revokeErr := range []error{nil, auth.ErrInvalidToken} {
+		setupTestStore(t, loggedInProfile("alice"))
+		revoked := stubRevoke(t, revokeErr)
+
+		if err := logoutCmd.RunE(logoutCmd, []string{"alice"}); err != nil {
+			t.Fatalf("logout failed (revoke error %v): %v", revokeErr, err)
+		}
+		if len(*revoked) != 1 || (*revoked)[0] != "refresh" {
+			t.Errorf("expected the refresh token to be revoked, got %v", *revoked)
+		}
+		p, ok := reloadProfile(t, "alice")
+		if !ok || p.AccessToken != "" || p.RefreshToken != "" || p.ExpiryTimestamp != 0 || p.RevokedAt == 0 {
+			t.Errorf("tokens not wiped after revocation: %+v", p)
+		}
+	}
+}
+
+func TestLogout_KeepsTokensWhenRevokeFails(t *testing.T) {
+	setupTestStore(t, loggedInProfile("alice"))
+	stubRevoke(t, errors.New("network down"))
+
+	if err := logoutCmd.RunE(logoutCmd, []string{"alice"}); err == nil {
+		t.Fatal("expected logout to fail")
+	}
+	if p, _ := reloadProfile(t, "alice"); p.RefreshToken != "refresh" || p.RevokedAt != 0 {
+		t.Errorf("tokens wiped although the grant is still valid: %+v", p)
+	}
+}
+
+func TestRemove_RevokeFailureNeedsForce(t *testing.T) {
+	setupTestStore(t, loggedInProfile("alice"))
+	stubRevoke(t, errors.New("network down"))
+	revokeOnRemove = true
+	t.Cleanup(func() { revokeOnRemove, forceRemove = false, false })
+
+	removeCmd.Run(removeCmd, []string{"alice"})
+	if _, ok := reloadProfile(t, "alice"); !ok {
+		t.Fatal("profile removed although revocation failed")
+	}
+
+	forceRemove = true
+	removeCmd.Run(removeCmd, []string{"alice"})
+	if _, ok := reloadProfile(t, "alice"); ok {
+		t.Error("--force did not remove the profile")
+	}
+}
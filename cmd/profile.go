@@ -3,7 +3,6 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 	"text/tabwriter"
 
 	"antigravity-cli/internal/config"
@@ -19,13 +18,16 @@ var (
 	proxyPass       string
 	proxyType       string
 	useSystemTunnel bool
+	revokeOnRemove  bool
+	forceRemove     bool
+	clearProxy      bool
 )
 
 // profileCmd represents the profile command
 var profileCmd = &cobra.Command{
 	Use:   "profile",
 	Short: "Manage profiles",
-	Long:  `Add, list, and remove profiles for Antigravity.`,
+	Long:  `Add, list, edit, rename, clone, remove, export and import profiles for Antigravity.`,
 }
 
 // addCmd represents the add command
@@ -84,7 +86,7 @@ var listCmd = &cobra.Command{
 		}
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-		fmt.Fprintln(w, "Name\tEmail\tProxy\tTunnel Mode")
+		fmt.Fprintln(w, "Name\tEmail\tProxy\tTunnel Mode\tSecrets")
 		
 		for _, p := range store.Profiles {
 			proxy := "None"
@@ -95,9 +97,16 @@ var listCmd = &cobra.Command{
 			if p.UseSystemTunnel {
 				tunnelMode = "System Tunnel (VLESS)"
 			}
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.Name, p.Email, proxy, tunnelMode)
+			state, _ := p.Secrets()
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", p.Name, p.Email, proxy, tunnelMode, state)
 		}
 		w.Flush()
+
+		// Explain profiles whose tokens are on disk but could not be read
+		for _, profileName := range store.UnreadableProfiles() {
+			state, err := store.Profiles[profileName].Secrets()
+			fmt.Printf("⚠️ %s: secrets %s: %v\n", profileName, state, err)
+		}
 	},
 }
 
@@ -114,16 +123,25 @@ var removeCmd = &cobra.Command{
 			return
 		}
 
-		if _, exists := store.Profiles[profileName]; !exists {
+		profile, exists := store.Profiles[profileName]
+		if !exists {
 			fmt.Printf("Profile '%s' not found.\n", profileName)
 			return
 		}
 
-		delete(store.Profiles, profileName)
-		
-		// We need to save manually since Store doesn't have a specific RemoveProfile method exposed with saving, 
-		// but we can call Save().
-		if err := store.Save(); err != nil {
+		if revokeOnRemove {
+			if err := revokeProfileTokens(profile); err != nil {
+				if !forceRemove {
+					fmt.Printf("Error: revocation failed, profile NOT removed: %v\n", err)
+					fmt.Println("The grant is still valid at Google. Use --force to remove the profile anyway.")
+					return
+				}
+				fmt.Printf("⚠️ Revocation failed: %v\n", err)
+				fmt.Println("⚠️ Removing anyway (--force). The grant is STILL VALID at Google until revoked from your Google account settings.")
+			}
+		}
+
+		if err := store.RemoveProfile(profileName); err != nil {
 			fmt.Printf("Error saving store after removal: %v\n", err)
 			return
 		}
@@ -132,6 +150,117 @@ var removeCmd = &cobra.Command{
 	},
 }
 
+// editCmd represents the edit command
+var editCmd = &cobra.Command{
+	Use:   "edit [name]",
+	Short: "Change a profile's settings",
+	Long: `Change a profile's settings in place. Only the flags you pass are changed;
+tokens are kept. --name renames the profile (same as 'profile rename').`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profileName := args[0]
+		store, err := getStore()
+		if err != nil {
+			return fmt.Errorf("error loading store: %v", err)
+		}
+
+		flags := cmd.Flags()
+		err = store.Update(profileName, func(p *config.Profile) error {
+			if flags.Changed("email") {
+				p.Email = email
+			}
+			if clearProxy {
+				p.ProxyScheme, p.ProxyHost, p.ProxyPort = "", "", 0
+				p.ProxyUser, p.ProxyPass = "", ""
+			}
+			if flags.Changed("proxy-type") {
+				p.ProxyScheme = proxyType
+			}
+			if flags.Changed("proxy-host") {
+				p.ProxyHost = proxyHost
+			}
+			if flags.Changed("proxy-port") {
+				p.ProxyPort = proxyPort
+			}
+			if flags.Changed("proxy-user") {
+				p.ProxyUser = proxyUser
+			}
+			if flags.Changed("proxy-pass") {
+				p.ProxyPass = proxyPass
+			}
+			if flags.Changed("use-system-tunnel") {
+				p.UseSystemTunnel = useSystemTunnel
+			}
+			return validateProfile(*p)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update profile: %v", err)
+		}
+
+		if flags.Changed("name") && name != profileName {
+			if err := store.RenameProfile(profileName, name); err != nil {
+				return fmt.Errorf("settings saved, but rename failed: %v", err)
+			}
+			profileName = name
+		}
+
+		fmt.Printf("Profile '%s' updated.\n", profileName)
+		return nil
+	},
+}
+
+// renameCmd represents the rename command
+var renameCmd = &cobra.Command{
+	Use:   "rename [old] [new]",
+	Short: "Rename a profile, keeping its tokens and identity",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := getStore()
+		if err != nil {
+			return fmt.Errorf("error loading store: %v", err)
+		}
+		if err := store.RenameProfile(args[0], args[1]); err != nil {
+			return fmt.Errorf("rename failed: %v", err)
+		}
+		fmt.Printf("Profile '%s' renamed to '%s'.\n", args[0], args[1])
+		return nil
+	},
+}
+
+// cloneCmd represents the clone command
+var cloneCmd = &cobra.Command{
+	Use:   "clone [source] [new]",
+	Short: "Create a new profile with another profile's proxy settings",
+	Long: `Create a new, unauthenticated profile that uses the same proxy and tunnel
+settings as the source. Run 'login' for the new profile afterwards.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := getStore()
+		if err != nil {
+			return fmt.Errorf("error loading store: %v", err)
+		}
+		if _, err := store.CloneProfile(args[0], args[1], email); err != nil {
+			return fmt.Errorf("clone failed: %v", err)
+		}
+		fmt.Printf("Profile '%s' created from '%s'. Run 'antigravity login %s' to sign in.\n", args[1], args[0], args[1])
+		return nil
+	},
+}
+
+// validateProfile checks settings that would only fail later, at connect time
+func validateProfile(p config.Profile) error {
+	if p.ProxyHost == "" {
+		return nil
+	}
+	if p.ProxyScheme != "socks5" && p.ProxyScheme != "http" {
+		return fmt.Errorf("unsupported proxy type '%s' (use socks5 or http)", p.ProxyScheme)
+	}
+	if p.ProxyPort < 1 || p.ProxyPort > 65535 {
+		return fmt.Errorf("invalid proxy port %d", p.ProxyPort)
+	}
+	return nil
+}
+
 func init() {
 	// add flags
 	addCmd.Flags().StringVar(&name, "name", "", "Profile name")
@@ -143,24 +272,36 @@ func init() {
 	addCmd.Flags().StringVar(&proxyType, "proxy-type", "socks5", "Proxy type (socks5/http)")
 	addCmd.Flags().BoolVar(&useSystemTunnel, "use-system-tunnel", false, "Use system tunnel (VLESS)")
 
+	editCmd.Flags().StringVar(&name, "name", "", "Rename the profile")
+	editCmd.Flags().StringVar(&email, "email", "", "Email address")
+	editCmd.Flags().StringVar(&proxyHost, "proxy-host", "", "Proxy host")
+	editCmd.Flags().IntVar(&proxyPort, "proxy-port", 0, "Proxy port")
+	editCmd.Flags().StringVar(&proxyUser, "proxy-user", "", "Proxy username")
+	editCmd.Flags().StringVar(&proxyPass, "proxy-pass", "", "Proxy password")
+	editCmd.Flags().StringVar(&proxyType, "proxy-type", "socks5", "Proxy type (socks5/http)")
+	editCmd.Flags().BoolVar(&useSystemTunnel, "use-system-tunnel", false, "Use system tunnel (VLESS)")
+	editCmd.Flags().BoolVar(&clearProxy, "clear-proxy", false, "Remove the proxy settings and credentials")
+
+	cloneCmd.Flags().StringVar(&email, "email", "", "Email address of the account the clone will log in as")
+
+	removeCmd.Flags().BoolVar(&revokeOnRemove, "revoke", false, "Revoke the profile's tokens at Google before removing")
+	removeCmd.Flags().BoolVar(&forceRemove, "force", false, "With --revoke, remove the profile even if revocation fails")
+
 	profileCmd.AddCommand(addCmd)
 	profileCmd.AddCommand(listCmd)
 	profileCmd.AddCommand(removeCmd)
+	profileCmd.AddCommand(editCmd)
+	profileCmd.AddCommand(renameCmd)
+	profileCmd.AddCommand(cloneCmd)
 }
 
 func getStore() (*config.Store, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return nil, err
-	}
-	// Store in ~/.antigravity-cli/profiles.json
-	configDir := filepath.Join(home, ".antigravity-cli")
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+	// Store in the data directory, ~/.antigravity-cli/profiles.json by default
+	if err := os.MkdirAll(config.DataDir(), 0700); err != nil {
 		return nil, err
 	}
-	
-	storePath := filepath.Join(configDir, "profiles.json")
-	store := config.NewStore(storePath)
+
+	store := config.NewStore(config.StorePath())
 	
 	if err := store.Load(); err != nil {
 		return nil, err
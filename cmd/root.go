@@ -3,13 +3,33 @@ package cmd
 import (
 	"os"
 
+	"antigravity-cli/internal/auth"
+	"antigravity-cli/internal/config"
+	"antigravity-cli/internal/session"
+
 	"github.com/spf13/cobra"
 )
 
+var configDirFlag string
+
+// Calls that go out to sing-box and Google, replaced in tests
+var (
+	openTunnel     = session.OpenTunnel
+	refreshTokens  = auth.RefreshAccessTokenViaProxy
+	fetchTokenInfo = auth.GetTokenInfoViaProxy
+	revokeToken    = auth.RevokeTokenViaProxy
+)
+
 var rootCmd = &cobra.Command{
 	Use:   "antigravity",
 	Short: "Antigravity CLI Manager",
 	Long:  `A CLI port of the AntigravityManager logic for managing cloud accounts and injection.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := config.InitSettings(configDirFlag); err != nil {
+			return err
+		}
+		return initSecurity()
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) == 0 {
 			runInteractiveMenu()
@@ -28,6 +48,7 @@ func Execute() {
 
 func init() {
 	// Global flags can be defined here
+	rootCmd.PersistentFlags().StringVar(&configDirFlag, "config-dir", "", "Directory with config.yaml and all data files (default $"+config.HomeEnv+", then $XDG_CONFIG_HOME/antigravity-cli)")
 	rootCmd.AddCommand(profileCmd)
 	rootCmd.AddCommand(loginCmd)
 }
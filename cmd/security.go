@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"antigravity-cli/internal/config"
+	"antigravity-cli/internal/security"
+
+	"github.com/manifoldco/promptui"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+)
+
+var (
+	securityProvider string
+	securityKeyFile  string
+	securityKDF      string
+	securityUseAgent bool
+	securityForce    bool
+	agentTTL         time.Duration
+)
+
+var securityCmd = &cobra.Command{
+	Use:   "security",
+	Short: "Manage the master key that encrypts stored credentials",
+}
+
+var securityInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Choose where the master key is kept",
+	Long: `Choose the key provider for the master key:
+
+  keyring     OS keyring (default; needs Secret Service on Linux)
+  passphrase  master key wrapped with a passphrase-derived key (argon2id or scrypt),
+              for headless machines without a keyring
+  keyfile     base64 master key in a file only you can read
+
+The current master key is moved to the new provider, so existing profiles
+stay readable.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		oldCfg := security.Config()
+		if oldCfg.PendingKeyID != "" {
+			return fmt.Errorf("a key rotation is unfinished, run 'antigravity security rotate-key' first")
+		}
+
+		newCfg := security.KeyConfig{
+			Provider: securityProvider,
+			UseAgent: securityUseAgent,
+		}
+		switch securityProvider {
+		case security.ProviderKeyring:
+		case security.ProviderKeyFile:
+			if securityKeyFile == "" {
+				return fmt.Errorf("--key-file is required for the keyfile provider")
+			}
+			path, err := filepath.Abs(securityKeyFile)
+			if err != nil {
+				return err
+			}
+			newCfg.KeyFile = path
+		case security.ProviderPassphrase:
+			params, err := security.DefaultPassphraseParams(securityKDF)
+			if err != nil {
+				return err
+			}
+			newCfg.Passphrase = params
+		default:
+			return fmt.Errorf("unknown provider '%s' (use keyring, passphrase or keyfile)", securityProvider)
+		}
+
+		// Carry the existing master key over, otherwise every stored token becomes unreadable
+		key, err := security.GetKey()
+		carriedOver := err == nil
+		if err != nil {
+			if !securityForce {
+				return fmt.Errorf("cannot unlock the current master key (%s): %v\n"+
+					"Use --force to start over with a new key; existing encrypted profiles will become unreadable", oldCfg.Provider, err)
+			}
+			fmt.Printf("⚠️ Current master key unavailable (%v), generating a new one.\n", err)
+			if key, err = security.GenerateKey(); err != nil {
+				return err
+			}
+		}
+
+		newCfg.KeyID = security.KeyID(key)
+		newProvider, err := security.NewProvider(newCfg)
+		if err != nil {
+			return err
+		}
+		if err := newProvider.StoreKey(key); err != nil {
+			return fmt.Errorf("failed to store key with %s provider: %v", newCfg.Provider, err)
+		}
+		if newCfg.Provider != security.ProviderPassphrase {
+			// The passphrase provider saves its parameters itself in StoreKey
+			if err := security.SaveConfig(newCfg); err != nil {
+				return fmt.Errorf("failed to save key config: %v", err)
+			}
+		}
+
+		// Don't leave a second copy behind in the old provider
+		if carriedOver && (oldCfg.Provider != newCfg.Provider || oldCfg.KeyFile != newCfg.KeyFile) {
+			if oldProvider, err := security.NewProvider(oldCfg); err == nil {
+				if err := oldProvider.DeleteKey(); err != nil {
+					fmt.Printf("⚠️ Could not remove the key from the %s provider: %v\n", oldCfg.Provider, err)
+				}
+			}
+		}
+
+		fmt.Printf("✓ Master key is now kept by the %s provider.\n", newCfg.Provider)
+		return nil
+	},
+}
+
+var securityRotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Replace the master key and re-encrypt all profiles",
+	Long: `Generate a new master key, re-encrypt every profile with it in one atomic
+write, and only then hand the new key to the key provider.
+
+If a rotation is interrupted, every profile stays readable; running
+rotate-key again finishes it with the same new key. Stop running sessions
+first, they keep using the old key until restarted.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		oldID, err := security.CurrentKeyID()
+		if err != nil {
+			return fmt.Errorf("cannot unlock the current master key: %v", err)
+		}
+
+		newKey, resumed, err := security.BeginRotation()
+		if err != nil {
+			return fmt.Errorf("failed to start rotation: %v", err)
+		}
+		if resumed {
+			fmt.Printf("Resuming interrupted rotation to key %s\n", security.KeyID(newKey))
+		}
+
+		store, err := getStore()
+		if err != nil {
+			return fmt.Errorf("failed to load profiles: %v", err)
+		}
+		reEncrypted := false
+		err = store.ReEncrypt(newKey, func() error {
+			reEncrypted = true
+			return security.CommitRotation(newKey)
+		})
+		if err != nil && !reEncrypted {
+			return fmt.Errorf("re-encryption failed, the old key is still in use: %v", err)
+		}
+		if err != nil {
+			return fmt.Errorf("profiles are re-encrypted but the new key was not saved: %v\n"+
+				"Run 'antigravity security rotate-key' again to finish", err)
+		}
+
+		fmt.Printf("✓ Master key rotated (%s -> %s), %d profile(s) re-encrypted.\n", oldID, security.KeyID(newKey), len(store.Profiles))
+		return nil
+	},
+}
+
+var securityStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the key provider and agent state",
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := security.Config()
+		fmt.Printf("Provider: %s\n", cfg.Provider)
+		if cfg.KeyFile != "" {
+			fmt.Printf("Key file: %s\n", cfg.KeyFile)
+		}
+		if cfg.Passphrase != nil {
+			fmt.Printf("KDF:      %s\n", cfg.Passphrase.KDF)
+		}
+		if cfg.PendingKeyID != "" {
+			fmt.Printf("Rotation: unfinished (new key %s), run 'antigravity security rotate-key' to complete\n", cfg.PendingKeyID)
+		}
+
+		running, unlocked := security.AgentStatus()
+		switch {
+		case !running:
+			fmt.Printf("Agent:    not running (use_agent: %v)\n", cfg.UseAgent)
+		case unlocked:
+			fmt.Printf("Agent:    running, unlocked (use_agent: %v)\n", cfg.UseAgent)
+		default:
+			fmt.Printf("Agent:    running, locked (use_agent: %v)\n", cfg.UseAgent)
+		}
+	},
+}
+
+var securityAgentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Run a key agent that caches the unlocked master key",
+	Long: `Run a key agent in the foreground. While it runs, other antigravity
+commands fetch the unlocked master key from it instead of asking for the
+passphrase again (requires use_agent, see 'security init --agent').
+The key is forgotten after --ttl or on 'security lock'.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fmt.Printf("Key agent listening on %s (ttl %s)\n", security.AgentSocketPath(), agentTTL)
+		return security.RunAgent(agentTTL)
+	},
+}
+
+var securityUnlockCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "Unlock the master key and hand it to the running agent",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := security.Unlock(); err != nil {
+			return fmt.Errorf("unlock failed: %v", err)
+		}
+		fmt.Println("✓ Master key unlocked and cached in the agent.")
+		return nil
+	},
+}
+
+var securityLockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Make the agent forget the master key",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := security.Lock(); err != nil {
+			return fmt.Errorf("lock failed: %v", err)
+		}
+		fmt.Println("✓ Agent locked.")
+		return nil
+	},
+}
+
+// promptPassphrase asks for the master key passphrase on the terminal
+func promptPassphrase(confirm bool) (string, error) {
+	return promptSecret("Master key passphrase", confirm)
+}
+
+// promptSecret asks for a passphrase on the terminal, twice if confirm is set
+func promptSecret(label string, confirm bool) (string, error) {
+	// Never block on a prompt nobody can answer (CI, pipes)
+	if !isatty.IsTerminal(os.Stdin.Fd()) && !isatty.IsCygwinTerminal(os.Stdin.Fd()) {
+		return "", security.ErrPassphraseRequired
+	}
+
+	prompt := promptui.Prompt{
+		Label: label,
+		Mask:  '*',
+	}
+	passphrase, err := prompt.Run()
+	if err != nil {
+		return "", err
+	}
+	if !confirm {
+		return passphrase, nil
+	}
+
+	if len(passphrase) < 8 {
+		return "", errors.New("passphrase must be at least 8 characters")
+	}
+	confirmPrompt := promptui.Prompt{
+		Label: "Repeat passphrase",
+		Mask:  '*',
+	}
+	repeated, err := confirmPrompt.Run()
+	if err != nil {
+		return "", err
+	}
+	if repeated != passphrase {
+		return "", errors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// initSecurity points the security package at key.json and installs the passphrase prompt
+func initSecurity() error {
+	security.PassphraseFunc = promptPassphrase
+	return security.Init(config.KeyConfigPath())
+}
+
+func init() {
+	securityInitCmd.Flags().StringVar(&securityProvider, "provider", security.ProviderKeyring, "Key provider (keyring/passphrase/keyfile)")
+	securityInitCmd.Flags().StringVar(&securityKeyFile, "key-file", "", "Key file path for the keyfile provider")
+	securityInitCmd.Flags().StringVar(&securityKDF, "kdf", security.KDFArgon2id, "KDF for the passphrase provider (argon2id/scrypt)")
+	securityInitCmd.Flags().BoolVar(&securityUseAgent, "agent", false, "Cache the unlocked key in 'security agent'")
+	securityInitCmd.Flags().BoolVar(&securityForce, "force", false, "Generate a new key if the current one cannot be unlocked")
+	securityAgentCmd.Flags().DurationVar(&agentTTL, "ttl", 8*time.Hour, "How long the agent keeps the key")
+
+	securityCmd.AddCommand(securityInitCmd)
+	securityCmd.AddCommand(securityRotateKeyCmd)
+	securityCmd.AddCommand(securityStatusCmd)
+	securityCmd.AddCommand(securityAgentCmd)
+	securityCmd.AddCommand(securityUnlockCmd)
+	securityCmd.AddCommand(securityLockCmd)
+	rootCmd.AddCommand(securityCmd)
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"antigravity-cli/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show and change settings in config.yaml",
+	Long: `Show and change settings in config.yaml. Keys are dotted paths:
+
+  ` + strings.Join(config.SettingKeys(), "\n  ") + `
+
+config.yaml lives in --config-dir, $` + config.HomeEnv + `, or $XDG_CONFIG_HOME/antigravity-cli.`,
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective settings",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out, err := config.ShowSettings()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("# %s\n# data directory: %s\n%s", config.SettingsPath(), config.DataDir(), out)
+		return nil
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print one setting",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		value, err := config.GetSetting(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Change one setting in config.yaml",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := config.SetSetting(args[0], args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("✓ %s = %s (%s)\n", args[0], args[1], config.SettingsPath())
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -1,15 +1,33 @@
 package cmd
 
 import (
+	"antigravity-cli/internal/config"
 	"antigravity-cli/internal/injection"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/manifoldco/promptui"
+	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
 )
 
+var (
+	syncInto        string
+	syncCreate      bool
+	syncShowSecrets bool
+	syncYes         bool
+)
+
 var syncCmd = &cobra.Command{
 	Use:   "sync",
 	Short: "Sync account from Antigravity IDE",
+	Long: `Read the account the IDE is signed in to. With --into the access token,
+refresh token, expiry, name and email are saved to a profile; --create makes
+the profile if it does not exist yet.
+
+Tokens are masked unless --show-secrets is given.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		fmt.Println("Syncing from IDE...")
 		account, err := injection.SyncFromIDE()
@@ -17,12 +35,122 @@ var syncCmd = &cobra.Command{
 			return fmt.Errorf("sync failed: %v", err)
 		}
 
-		fmt.Printf("found account: %s (%s)\n", account.Email, account.Name)
-		fmt.Printf("token: %s...\n", account.AccessToken[:10])
-		return nil
+		email := account.Email
+		if email == "" {
+			email = "unknown email"
+		}
+		fmt.Printf("found account: %s (%s)\n", email, account.Name)
+		printToken("access token", account.AccessToken)
+		printToken("refresh token", account.RefreshToken)
+		if !account.Expiry.IsZero() {
+			fmt.Printf("expires: %s\n", account.Expiry.Local().Format(time.RFC1123))
+		}
+
+		if syncInto == "" {
+			return nil
+		}
+		return syncIntoProfile(syncInto, account)
 	},
 }
 
+func printToken(label, token string) {
+	if syncShowSecrets {
+		fmt.Printf("%s: %s\n", label, token)
+		return
+	}
+	fmt.Printf("%s: %s\n", label, injection.MaskToken(token))
+}
+
+// syncIntoProfile saves the IDE account's tokens and identity to a profile
+func syncIntoProfile(profileName string, account *injection.Account) error {
+	store, err := getStore()
+	if err != nil {
+		return fmt.Errorf("error loading store: %v", err)
+	}
+
+	existing, exists := store.GetProfile(profileName)
+	if !exists && !syncCreate {
+		return fmt.Errorf("profile '%s' not found, add --create to make it", profileName)
+	}
+	// A different account: the old one's Google ID, name and avatar go too
+	otherAccount := exists && account.Email != "" && existing.Email != "" && !strings.EqualFold(existing.Email, account.Email)
+	if otherAccount {
+		ok, err := confirmOverwrite(fmt.Sprintf("Profile '%s' belongs to %s, overwrite it with %s", profileName, existing.Email, account.Email))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Nothing changed.")
+			return nil
+		}
+	}
+
+	expiry := int64(0)
+	if !account.Expiry.IsZero() {
+		expiry = account.Expiry.Unix()
+	}
+	apply := func(p *config.Profile) {
+		p.AccessToken = account.AccessToken
+		p.RefreshToken = account.RefreshToken
+		p.ExpiryTimestamp = expiry
+		if otherAccount {
+			p.GoogleID, p.DisplayName, p.AvatarURL = "", "", ""
+		}
+		if account.Email != "" {
+			p.Email = account.Email
+		}
+		if account.Name != "" {
+			p.DisplayName = account.Name
+		}
+		if account.AvatarURL != "" {
+			p.AvatarURL = account.AvatarURL
+		}
+	}
+
+	if !exists {
+		if account.Email == "" {
+			return fmt.Errorf("the IDE has no email for this account, create the profile with 'profile add' first")
+		}
+		profile := config.Profile{Name: profileName}
+		apply(&profile)
+		if err := store.AddProfile(profile); err != nil {
+			return fmt.Errorf("failed to create profile: %v", err)
+		}
+		fmt.Printf("✓ Created profile '%s' from the IDE account\n", profileName)
+		return nil
+	}
+
+	err = store.Update(profileName, func(p *config.Profile) error {
+		apply(p)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save profile: %v", err)
+	}
+	fmt.Printf("✓ Saved the IDE account to profile '%s'\n", profileName)
+	return nil
+}
+
+// confirmOverwrite asks a yes/no question; --yes answers it, and without a
+// terminal to ask on it fails
+func confirmOverwrite(label string) (bool, error) {
+	if syncYes {
+		return true, nil
+	}
+	if !isatty.IsTerminal(os.Stdin.Fd()) && !isatty.IsCygwinTerminal(os.Stdin.Fd()) {
+		return false, fmt.Errorf("%s? Re-run with --yes to confirm", label)
+	}
+	prompt := promptui.Prompt{Label: label, IsConfirm: true}
+	if _, err := prompt.Run(); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
 func init() {
+	syncCmd.Flags().StringVar(&syncInto, "into", "", "Save the IDE account to this profile")
+	syncCmd.Flags().BoolVar(&syncCreate, "create", false, "Create the --into profile if it does not exist")
+	syncCmd.Flags().BoolVar(&syncShowSecrets, "show-secrets", false, "Print tokens in full")
+	syncCmd.Flags().BoolVarP(&syncYes, "yes", "y", false, "Overwrite a profile with a different email without asking")
 	rootCmd.AddCommand(syncCmd)
-}
\ No newline at end of file
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"antigravity-cli/internal/config"
+	"antigravity-cli/internal/injection"
+)
+
+// setSyncFlags sets the flags of 'sync' for one test and takes stdin away,
+// so confirmOverwrite sees no terminal
+func setSyncFlags(t *testing.T, create, yes bool) {
+	t.Helper()
+	syncCreate, syncYes = create, yes
+	stdin, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStdin := os.Stdin
+	os.Stdin = stdin
+	t.Cleanup(func() {
+		syncCreate, syncYes = false, false
+		os.Stdin = oldStdin
+		stdin.Close()
+	})
+}
+
+func ideAccount(email string) *injection.Account {
+	return &injection.Account{
+		Name:         "IDE User",
+		Email:        email,
+		AccessToken:  "ide-access",
+		RefreshToken: "ide-refresh",
+		Expiry:       time.Unix(1767225600, 0),
+	}
+}
+
+func TestSyncIntoProfile_Create(t *testing.T) {
+	setupTestStore(t)
+
+	setSyncFlags(t, false, false)
+	if err := syncIntoProfile("new", ideAccount("me@example.com")); err == nil {
+		t.Fatal("expected a missing profile to need --create")
+	}
+
+	setSyncFlags(t, true, false)
+	if err := syncIntoProfile("new", ideAccount("me@example.com")); err != nil {
+		t.Fatalf("sync --create failed: %v", err)
+	}
+	p, ok := reloadProfile(t, "new")
+	if !ok || p.Email != "me@example.com" || p.DisplayName != "IDE User" || p.AccessToken != "ide-access" ||
+		p.RefreshToken != "ide-refresh" || p.ExpiryTimestamp != 1767225600 {
+		t.Errorf("profile not created from the IDE account: %+v", p)
+	}
+}
+
+func TestSyncIntoProfile_UpdateKeepsSettings(t *testing.T) {
+	setupTestStore(t, config.Profile{Name: "work", Email: "me@example.com", ProxyHost: "proxy", AccessToken: "old", RefreshToken: "old"})
+	setSyncFlags(t, false, false)
+
+	if err := syncIntoProfile("work", ideAccount("me@example.com")); err != nil {
+		t.Fatalf("sync --into failed: %v", err)
+	}
+	p, _ := reloadProfile(t, "work")
+	if p.AccessToken != "ide-access" || p.RefreshToken != "ide-refresh" || p.ProxyHost != "proxy" {
+		t.Errorf("unexpected profile after sync: %+v", p)
+	}
+}
+
+func TestSyncIntoProfile_EmailMismatch(t *testing.T) {
+	setupTestStore(t, config.Profile{Name: "work", Email: "work@example.com", GoogleID: "111", DisplayName: "Work", AvatarURL: "https://example.com/w.png", AccessToken: "old", RefreshToken: "old"})
+
+	// Without a terminal to ask on, a different account needs --yes
+	setSyncFlags(t, false, false)
+	err := syncIntoProfile("work", ideAccount("other@example.com"))
+	if err == nil || !strings.Contains(err.Error(), "--yes") {
+		t.Fatalf("expected the overwrite to need --yes, got %v", err)
+	}
+	if p, _ := reloadProfile(t, "work"); p.Email != "work@example.com" || p.AccessToken != "old" {
+		t.Fatalf("profile changed without confirmation: %+v", p)
+	}
+
+	setSyncFlags(t, false, true)
+	if err := syncIntoProfile("work", ideAccount("other@example.com")); err != nil {
+		t.Fatalf("sync --yes failed: %v", err)
+	}
+	p, _ := reloadProfile(t, "work")
+	if p.Email != "other@example.com" || p.AccessToken != "ide-access" || p.DisplayName != "IDE User" {
+		t.Errorf("profile not overwritten with --yes: %+v", p)
+	}
+	// The IDE has no avatar, the old account's must not stay
+	if p.GoogleID != "" || p.AvatarURL != "" {
+		t.Errorf("old account's identity kept: %+v", p)
+	}
+}
+
+func TestSyncIntoProfile_EmailCaseIsNotAMismatch(t *testing.T) {
+	setupTestStore(t, config.Profile{Name: "work", Email: "Me@Example.com", GoogleID: "111", AccessToken: "old"})
+	setSyncFlags(t, false, false)
+
+	if err := syncIntoProfile("work", ideAccount("me@example.com")); err != nil {
+		t.Fatalf("sync --into asked to confirm a case-only difference: %v", err)
+	}
+	if p, _ := reloadProfile(t, "work"); p.GoogleID != "111" || p.AccessToken != "ide-access" {
+		t.Errorf("unexpected profile after sync: %+v", p)
+	}
+}
@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"antigravity-cli/internal/auth"
+	"antigravity-cli/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	tokenStatusAll     bool
+	tokenStatusJSON    bool
+	tokenStatusRefresh bool
+)
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Inspect stored OAuth tokens",
+}
+
+var tokenStatusCmd = &cobra.Command{
+	Use:   "status [profile_name]",
+	Short: "Introspect tokens, scopes and expiry for profiles",
+	Long: `Ask Google's tokeninfo endpoint (through each profile's proxy) about the
+stored access token, check that the refresh token still works, and compare
+the granted scopes against the ones Antigravity requires. A refreshed access
+token is saved.
+
+With --refresh=false the refresh token is only used when the access token is
+missing, expired or rejected.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && !tokenStatusAll {
+			return fmt.Errorf("specify a profile name or --all")
+		}
+
+		store, err := getStore()
+		if err != nil {
+			return fmt.Errorf("error loading store: %v", err)
+		}
+
+		var profiles []config.Profile
+		if tokenStatusAll {
+			for _, p := range store.Profiles {
+				profiles = append(profiles, p)
+			}
+			sort.Slice(profiles, func(i, j int) bool {
+				return profiles[i].Name < profiles[j].Name
+			})
+		} else {
+			p, ok := store.GetProfile(args[0])
+			if !ok {
+				return fmt.Errorf("profile '%s' not found", args[0])
+			}
+			profiles = append(profiles, p)
+		}
+
+		var statuses []tokenStatus
+		for _, p := range profiles {
+			if !tokenStatusJSON {
+				fmt.Fprintf(os.Stderr, "Checking '%s'...\n", p.Name)
+			}
+			status, refreshed := checkTokenStatus(p, tokenStatusRefresh)
+			statuses = append(statuses, status)
+
+			// A working refresh token gave us a fresh access token, keep it
+			if refreshed != nil {
+				err := store.Update(p.Name, func(stored *config.Profile) error {
+					stored.AccessToken = refreshed.AccessToken
+					stored.RefreshToken = refreshed.RefreshToken
+					stored.ExpiryTimestamp = refreshed.ExpiryTimestamp
+					return nil
+				})
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "⚠️ Failed to save refreshed token for '%s': %v\n", p.Name, err)
+				}
+			}
+		}
+
+		if tokenStatusJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(statuses)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "Name\tEmail\tExpires\tRefresh Token\tScopes\tStatus")
+		for _, s := range statuses {
+			expires := "-"
+			if s.Expiry != 0 {
+				expires = time.Unix(s.Expiry, 0).Format("2006-01-02 15:04")
+			}
+			refresh := "OK"
+			switch {
+			case !s.RefreshChecked && s.Error != "":
+				refresh = "-"
+			case !s.RefreshChecked:
+				refresh = "not checked"
+			case !s.RefreshOK:
+				refresh = "FAILED"
+			}
+			scopes := fmt.Sprintf("%d/%d", len(auth.Scopes)-len(s.MissingScopes), len(auth.Scopes))
+			if s.Error != "" && len(s.GrantedScopes) == 0 {
+				scopes = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", s.Profile, s.Email, expires, refresh, scopes, s.summary())
+		}
+		w.Flush()
+
+		for _, s := range statuses {
+			if len(s.MissingScopes) > 0 && len(s.GrantedScopes) > 0 {
+				fmt.Printf("\n⚠️ '%s' is missing required scopes:\n", s.Profile)
+				for _, scope := range s.MissingScopes {
+					fmt.Printf("   - %s\n", scope)
+				}
+			}
+		}
+		return nil
+	},
+}
+
+// tokenStatus is one row of 'token status' output
+type tokenStatus struct {
+	Profile       string   `json:"profile"`
+	Email         string   `json:"email"`
+	ProfileEmail  string   `json:"profile_email"`
+	Expiry        int64    `json:"expiry"`
+	GrantedScopes []string `json:"granted_scopes"`
+	MissingScopes []string `json:"missing_scopes"`
+	// Secrets is the profile's decryption state, as in 'profile list'
+	Secrets string `json:"secrets"`
+	// RefreshChecked tells whether the refresh token was used at all
+	RefreshChecked bool   `json:"refresh_checked"`
+	RefreshOK      bool   `json:"refresh_ok"`
+	Error          string `json:"error,omitempty"`
+}
+
+func (s tokenStatus) summary() string {
+	switch {
+	case s.Error != "":
+		return s.Error
+	case len(s.MissingScopes) > 0:
+		return "MISSING SCOPES"
+	case !strings.EqualFold(s.Email, s.ProfileEmail):
+		return "EMAIL MISMATCH"
+	default:
+		return "OK"
+	}
+}
+
+// checkTokenStatus introspects the profile's tokens through its proxy. With
+// checkRefresh the refresh token is always tried, otherwise only when the
+// access token is missing, expired or rejected; the refreshed profile is
+// returned then.
+func checkTokenStatus(p config.Profile, checkRefresh bool) (tokenStatus, *config.Profile) {
+	state, secretErr := p.Secrets()
+	status := tokenStatus{
+		Profile:      p.Name,
+		ProfileEmail: p.Email,
+		Secrets:      state.String(),
+	}
+
+	// Unreadable tokens are not the same as no tokens
+	if state == config.SecretsLocked || state == config.SecretsCorrupted {
+		status.Error = fmt.Sprintf("secrets %s: %v", state, secretErr)
+		return status, nil
+	}
+	if !hasTokens(p) {
+		status.Error = "not logged in"
+		return status, nil
+	}
+
+	t, err := openTunnel(p)
+	if err != nil {
+		status.Error = fmt.Sprintf("tunnel failed: %v", err)
+		return status, nil
+	}
+	defer t.Close()
+
+	var refreshed *config.Profile
+	refresh := func() {
+		status.RefreshChecked = true
+		tokenResp, err := refreshTokens(p.RefreshToken, t.Port)
+		if err != nil {
+			return
+		}
+		status.RefreshOK = true
+		p.AccessToken = tokenResp.AccessToken
+		p.ExpiryTimestamp = time.Now().Unix() + tokenResp.ExpiresIn
+		if tokenResp.RefreshToken != "" {
+			p.RefreshToken = tokenResp.RefreshToken
+		}
+		refreshed = &p
+	}
+
+	hasAccessToken := p.AccessToken != "" && p.AccessToken != "pending_auth"
+	if checkRefresh || !hasAccessToken || p.ExpiryTimestamp <= time.Now().Unix() {
+		refresh()
+	}
+
+	info, err := fetchTokenInfo(p.AccessToken, t.Port)
+	if errors.Is(err, auth.ErrInvalidToken) && !status.RefreshChecked {
+		// Revoked or expired early: the refresh token decides if the login still works
+		refresh()
+		if status.RefreshOK {
+			info, err = fetchTokenInfo(p.AccessToken, t.Port)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			status.Error = "access token invalid"
+			if !status.RefreshOK {
+				status.Error = "access token invalid, refresh failed"
+			}
+		} else {
+			status.Error = err.Error()
+		}
+		return status, refreshed
+	}
+
+	status.Email = info.Email
+	status.Expiry = info.Expiry
+	status.GrantedScopes = info.Scopes()
+	status.MissingScopes = info.MissingScopes()
+	if status.RefreshChecked && !status.RefreshOK {
+		status.Error = "refresh token not working"
+	}
+	return status, refreshed
+}
+
+func init() {
+	tokenStatusCmd.Flags().BoolVar(&tokenStatusAll, "all", false, "Check every profile")
+	tokenStatusCmd.Flags().BoolVar(&tokenStatusJSON, "json", false, "Output as JSON")
+	tokenStatusCmd.Flags().BoolVar(&tokenStatusRefresh, "refresh", true, "Check the refresh token; with --refresh=false it is only used when the access token needs it")
+
+	tokenCmd.AddCommand(tokenStatusCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"antigravity-cli/internal/auth"
+	"antigravity-cli/internal/config"
+	"antigravity-cli/internal/security"
+	"antigravity-cli/internal/session"
+
+	"github.com/zalando/go-keyring"
+)
+
+// setupTestStore points the CLI at a temp config dir with a mock keyring and
+// stores the given profiles
+func setupTestStore(t *testing.T, profiles ...config.Profile) *config.Store {
+	t.Helper()
+	keyring.MockInit()
+	if err := config.InitSettings(t.TempDir()); err != nil {
+		t.Fatalf("InitSettings failed: %v", err)
+	}
+	if err := security.Init(config.KeyConfigPath()); err != nil {
+		t.Fatalf("security.Init failed: %v", err)
+	}
+	store, err := getStore()
+	if err != nil {
+		t.Fatalf("getStore failed: %v", err)
+	}
+	for _, p := range profiles {
+		if err := store.AddProfile(p); err != nil {
+			t.Fatalf("AddProfile failed: %v", err)
+		}
+	}
+	return store
+}
+
+// reloadProfile reads a profile back from disk
+func reloadProfile(t *testing.T, name string) (config.Profile, bool) {
+	t.Helper()
+	store, err := getStore()
+	if err != nil {
+		t.Fatalf("getStore failed: %v", err)
+	}
+	return store.GetProfile(name)
+}
+
+// stubTunnel makes openTunnel succeed without starting sing-box
+func stubTunnel(t *testing.T) {
+	t.Helper()
+	old := openTunnel
+	openTunnel = func(config.Profile) (*session.Tunnel, error) { return &session.Tunnel{Port: 1}, nil }
+	t.Cleanup(func() { openTunnel = old })
+}
+
+// stubGoogle answers refresh and tokeninfo requests. A nil refreshErr hands
+// out "fresh-access"; tokeninfo accepts only the tokens in valid.
+func stubGoogle(t *testing.T, refreshErr error, valid ...string) *int {
+	t.Helper()
+	stubTunnel(t)
+	refreshes := 0
+	oldRefresh, oldInfo := refreshTokens, fetchTokenInfo
+	refreshTokens = func(refreshToken string, port int) (*auth.TokenResponse, error) {
+		refreshes++
+		if refreshErr != nil {
+			return nil, refreshErr
+		}
+		return &auth.TokenResponse{AccessToken: "fresh-access", ExpiresIn: 3600}, nil
+	}
+	fetchTokenInfo = func(accessToken string, port int) (*auth.TokenInfo, error) {
+		for _, v := range append(valid, "fresh-access") {
+			if accessToken == v {
+				return &auth.TokenInfo{Email: "alice@example.com", Scope: "https://www.googleapis.com/auth/cloud-platform"}, nil
+			}
+		}
+		return nil, auth.ErrInvalidToken
+	}
+	t.Cleanup(func() { refreshTokens, fetchTokenInfo = oldRefresh, oldInfo })
+	return &refreshes
+}
+
+func TestCheckTokenStatus_ValidTokenIsNotRefreshed(t *testing.T) {
+	refreshes := stubGoogle(t, nil, "access")
+	p := config.Profile{Name: "alice", Email: "alice@example.com", AccessToken: "access", RefreshToken: "refresh", ExpiryTimestamp: time.Now().Add(time.Hour).Unix()}
+
+	status, refreshed := checkTokenStatus(p, false)
+	if *refreshes != 0 || refreshed != nil {
+		t.Fatalf("valid access token was refreshed (%d calls)", *refreshes)
+	}
+	if status.RefreshChecked || status.Error != "" || status.Email != "alice@example.com" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	status, refreshed = checkTokenStatus(p, true)
+	if *refreshes != 1 || refreshed == nil || !status.RefreshOK {
+		t.Errorf("--refresh did not use the refresh token: %+v", status)
+	}
+}
+
+func TestCheckTokenStatus_RefreshesExpiredOrRejectedToken(t *testing.T) {
+	refreshes := stubGoogle(t, nil)
+
+	expired := config.Profile{Name: "alice", AccessToken: "access", RefreshToken: "refresh", ExpiryTimestamp: time.Now().Add(-time.Minute).Unix()}
+	status, refreshed := checkTokenStatus(expired, false)
+	if *refreshes != 1 || refreshed == nil || refreshed.AccessToken != "fresh-access" || status.Error != "" {
+		t.Errorf("expired token not refreshed: %+v", status)
+	}
+
+	// Not expired by the clock, but tokeninfo rejects it (revoked)
+	rejected := expired
+	rejected.ExpiryTimestamp = time.Now().Add(time.Hour).Unix()
+	status, refreshed = checkTokenStatus(rejected, false)
+	if *refreshes != 2 || refreshed == nil || status.Error != "" {
+		t.Errorf("rejected token not refreshed: %+v", status)
+	}
+}
+
+func TestCheckTokenStatus_RefreshFailure(t *testing.T) {
+	stubGoogle(t, errors.New("invalid_grant"))
+	p := config.Profile{Name: "alice", AccessToken: "access", RefreshToken: "refresh"}
+
+	status, refreshed := checkTokenStatus(p, false)
+	if refreshed != nil || !status.RefreshChecked || status.RefreshOK {
+		t.Fatalf("unexpected refresh outcome: %+v", status)
+	}
+	if status.Error != "access token invalid, refresh failed" {
+		t.Errorf("unexpected error: %q", status.Error)
+	}
+}
+
+func TestTokenStatus_ChecksRefreshTokenByDefault(t *testing.T) {
+	setupTestStore(t, config.Profile{Name: "alice", Email: "alice@example.com", AccessToken: "access", RefreshToken: "refresh", ExpiryTimestamp: time.Now().Add(time.Hour).Unix()})
+	refreshes := stubGoogle(t, nil, "access")
+	tokenStatusAll, tokenStatusJSON = true, true
+	t.Cleanup(func() { tokenStatusAll, tokenStatusJSON = false, false })
+
+	if !tokenStatusRefresh {
+		t.Fatal("--refresh should default to true")
+	}
+	if err := tokenStatusCmd.RunE(tokenStatusCmd, nil); err != nil {
+		t.Fatalf("token status failed: %v", err)
+	}
+	if *refreshes != 1 {
+		t.Errorf("refresh token checked %d times, want 1", *refreshes)
+	}
+	if p, _ := reloadProfile(t, "alice"); p.AccessToken != "fresh-access" {
+		t.Errorf("refreshed token not saved: %+v", p)
+	}
+}
+
+func TestTokenStatus_NoRefreshSavesOnlyRefreshedTokens(t *testing.T) {
+	future := time.Now().Add(time.Hour).Unix()
+	setupTestStore(t,
+		config.Profile{Name: "alice", Email: "alice@example.com", AccessToken: "access", RefreshToken: "refresh", ExpiryTimestamp: future},
+		config.Profile{Name: "bob", Email: "bob@example.com", AccessToken: "stale", RefreshToken: "refresh"},
+	)
+	stubGoogle(t, nil, "access")
+	tokenStatusAll, tokenStatusJSON, tokenStatusRefresh = true, true, false
+	t.Cleanup(func() { tokenStatusAll, tokenStatusJSON, tokenStatusRefresh = false, false, true })
+
+	if err := tokenStatusCmd.RunE(tokenStatusCmd, nil); err != nil {
+		t.Fatalf("token status failed: %v", err)
+	}
+	if p, _ := reloadProfile(t, "alice"); p.AccessToken != "access" || p.ExpiryTimestamp != future {
+		t.Errorf("valid profile was rewritten: %+v", p)
+	}
+	if p, _ := reloadProfile(t, "bob"); p.AccessToken != "fresh-access" {
+		t.Errorf("refreshed token not saved: %+v", p)
+	}
+}
+
+func TestCheckTokenStatus_LockedSecretsAreNotLoggedOut(t *testing.T) {
+	setupTestStore(t, config.Profile{Name: "alice", Email: "alice@example.com", AccessToken: "access", RefreshToken: "refresh"})
+	stubGoogle(t, nil, "access")
+
+	// Tag the blob with a master key we don't have
+	raw, err := os.ReadFile(config.StorePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	doc["profiles"].([]any)[0].(map[string]any)["key_id"] = "0000000000000000"
+	if raw, err = json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config.StorePath(), raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, _ := reloadProfile(t, "alice")
+	status, refreshed := checkTokenStatus(p, true)
+	if refreshed != nil || status.Secrets != "locked" || !strings.HasPrefix(status.Error, "secrets locked") {
+		t.Errorf("unexpected status for a locked profile: %+v", status)
+	}
+}
@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"antigravity-cli/internal/config"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -20,8 +22,14 @@ const (
 	AuthURL  = "https://accounts.google.com/o/oauth2/v2/auth"
 	TokenURL = "https://oauth2.googleapis.com/token"
 	UserInfoURL = "https://www.googleapis.com/oauth2/v2/userinfo"
+	RevokeURL = "https://oauth2.googleapis.com/revoke"
+	TokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
 )
 
+// ErrInvalidToken is returned by RevokeTokenViaProxy when Google no longer
+// recognises the token, i.e. it has already been revoked or has expired.
+var ErrInvalidToken = errors.New("token is invalid or already revoked")
+
 // Scopes required for the application
 var Scopes = []string{
 	"https://www.googleapis.com/auth/cloud-platform",
@@ -52,6 +60,38 @@ type UserInfo struct {
 	Locale        string `json:"locale"`
 }
 
+// TokenInfo represents the response from Google's tokeninfo endpoint
+type TokenInfo struct {
+	Audience      string `json:"aud"`
+	Subject       string `json:"sub"`
+	Scope         string `json:"scope"`
+	Expiry        int64  `json:"exp,string"`
+	ExpiresIn     int64  `json:"expires_in,string"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified,string"`
+	AccessType    string `json:"access_type"`
+}
+
+// Scopes returns the granted scopes as a slice
+func (t *TokenInfo) Scopes() []string {
+	return strings.Fields(t.Scope)
+}
+
+// MissingScopes returns the required Scopes that were not granted
+func (t *TokenInfo) MissingScopes() []string {
+	granted := make(map[string]bool)
+	for _, s := range t.Scopes() {
+		granted[s] = true
+	}
+	var missing []string
+	for _, s := range Scopes {
+		if !granted[s] {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
 // GetAuthURL generates the Google OAuth authorization URL
 func GetAuthURL() string {
 	params := url.Values{}
@@ -130,9 +170,8 @@ func GetUserInfo(accessToken string) (*UserInfo, error) {
 	return &userInfo, nil
 }
 
-// RefreshAccessTokenViaProxy uses refresh token to get new access token via SOCKS5 proxy
-func RefreshAccessTokenViaProxy(refreshToken string, proxyPort int) (*TokenResponse, error) {
-	// Create SOCKS5 dialer for the local sing-box tunnel
+// newProxyClient returns an HTTP client that goes through the local sing-box SOCKS5 tunnel
+func newProxyClient(proxyPort int) (*http.Client, error) {
 	proxyURL, err := url.Parse(fmt.Sprintf("socks5://127.0.0.1:%d", proxyPort))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse proxy URL: %w", err)
@@ -142,9 +181,18 @@ func RefreshAccessTokenViaProxy(refreshToken string, proxyPort int) (*TokenRespo
 		Proxy: http.ProxyURL(proxyURL),
 	}
 
-	client := &http.Client{
+	return &http.Client{
 		Transport: transport,
-		Timeout:   30 * time.Second,
+		Timeout:   time.Duration(config.Current().Auth.HTTPTimeout),
+	}, nil
+}
+
+// RefreshAccessTokenViaProxy uses refresh token to get new access token via SOCKS5 proxy
+func RefreshAccessTokenViaProxy(refreshToken string, proxyPort int) (*TokenResponse, error) {
+	// Create client for the local sing-box tunnel
+	client, err := newProxyClient(proxyPort)
+	if err != nil {
+		return nil, err
 	}
 
 	// Prepare refresh token request
@@ -182,3 +230,87 @@ func RefreshAccessTokenViaProxy(refreshToken string, proxyPort int) (*TokenRespo
 
 	return &tokenResp, nil
 }
+
+// RevokeTokenViaProxy revokes a token at Google via SOCKS5 proxy.
+// Revoking the refresh token invalidates the whole grant, including access tokens issued from it.
+func RevokeTokenViaProxy(token string, proxyPort int) error {
+	client, err := newProxyClient(proxyPort)
+	if err != nil {
+		return err
+	}
+
+	data := url.Values{}
+	data.Set("token", token)
+
+	req, err := http.NewRequest("POST", RevokeURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &errResp) == nil && errResp.Error == "invalid_token" {
+		return ErrInvalidToken
+	}
+	return fmt.Errorf("token revocation failed with status %d: %s", resp.StatusCode, string(body))
+}
+
+// GetTokenInfoViaProxy introspects an access token via SOCKS5 proxy.
+// It returns ErrInvalidToken when the token is expired or revoked.
+func GetTokenInfoViaProxy(accessToken string, proxyPort int) (*TokenInfo, error) {
+	client, err := newProxyClient(proxyPort)
+	if err != nil {
+		return nil, err
+	}
+
+	data := url.Values{}
+	data.Set("access_token", accessToken)
+
+	req, err := http.NewRequest("POST", TokenInfoURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch token info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusBadRequest {
+		return nil, ErrInvalidToken
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tokeninfo request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var info TokenInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse tokeninfo response: %w", err)
+	}
+
+	return &info, nil
+}
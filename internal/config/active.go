@@ -7,8 +7,7 @@ import (
 )
 
 func getActiveProfilePath() string {
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".antigravity-cli", "active_profile")
+	return filepath.Join(DataDir(), "active_profile")
 }
 
 // GetActiveProfileName reads the active profile name from disk.
@@ -25,7 +24,7 @@ func GetActiveProfileName() string {
 func SetActiveProfileName(name string) error {
 	path := getActiveProfilePath()
 	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	if err := os.MkdirAll(dir, 0700); err != nil {
 		return err
 	}
 	return os.WriteFile(path, []byte(name), 0644)
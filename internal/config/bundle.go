@@ -0,0 +1,202 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/google/uuid"
+)
+
+// A bundle carries profiles, tokens included, from one machine to another.
+// Stored blobs are bound to the local master key, so the bundle holds the
+// decrypted secrets instead and is itself encrypted with age, either to a
+// passphrase (scrypt) or to age recipients.
+
+const bundleVersion = 1
+
+type bundleDocument struct {
+	Version    int           `json:"version"`
+	ExportedAt int64         `json:"exported_at"`
+	Profiles   []bundleEntry `json:"profiles"`
+}
+
+type bundleEntry struct {
+	Profile Profile       `json:"profile"`
+	Secrets SensitiveData `json:"secrets"`
+}
+
+// ConflictPolicy decides what Import does with a profile whose name is taken
+type ConflictPolicy string
+
+const (
+	ConflictSkip      ConflictPolicy = "skip"
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	ConflictRename    ConflictPolicy = "rename"
+)
+
+// ImportResult describes what happened to one imported profile
+type ImportResult struct {
+	Name       string // name in the bundle
+	ImportedAs string // local name, empty if skipped
+	Action     string // added, overwritten, renamed, skipped
+}
+
+// ParseConflictPolicy validates a --on-conflict value
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case ConflictSkip, ConflictOverwrite, ConflictRename:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown conflict policy %q (use skip, overwrite or rename)", s)
+	}
+}
+
+// WriteBundle encrypts profiles, secrets included, to the recipients and
+// writes the ASCII-armored bundle to w. Profiles whose secrets could not be
+// decrypted are refused, they would arrive without tokens.
+func WriteBundle(w io.Writer, profiles []Profile, recipients ...age.Recipient) error {
+	doc := bundleDocument{Version: bundleVersion, ExportedAt: time.Now().Unix()}
+	for _, p := range profiles {
+		if state, err := p.Secrets(); state == SecretsLocked || state == SecretsCorrupted {
+			return fmt.Errorf("%w: %s (%v)", ErrSecretsUnreadable, p.Name, err)
+		}
+		secrets := SensitiveData{
+			AccessToken:     p.AccessToken,
+			RefreshToken:    p.RefreshToken,
+			ExpiryTimestamp: p.ExpiryTimestamp,
+			ProxyUser:       p.ProxyUser,
+			ProxyPass:       p.ProxyPass,
+		}
+		doc.Profiles = append(doc.Profiles, bundleEntry{Profile: portable(p), Secrets: secrets})
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	armored := armor.NewWriter(w)
+	encrypted, err := age.Encrypt(armored, recipients...)
+	if err != nil {
+		return err
+	}
+	if _, err := encrypted.Write(data); err != nil {
+		return err
+	}
+	if err := encrypted.Close(); err != nil {
+		return err
+	}
+	return armored.Close()
+}
+
+// ReadBundle decrypts a bundle and returns its profiles with secrets filled in
+func ReadBundle(r io.Reader, identities ...age.Identity) ([]Profile, error) {
+	decrypted, err := age.Decrypt(armor.NewReader(r), identities...)
+	if err != nil {
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) {
+			return nil, fmt.Errorf("wrong passphrase or identity: %w", err)
+		}
+		return nil, fmt.Errorf("failed to decrypt bundle: %w", err)
+	}
+
+	var doc bundleDocument
+	if err := json.NewDecoder(decrypted).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("bundle content is not valid: %w", err)
+	}
+	if doc.Version > bundleVersion {
+		return nil, fmt.Errorf("bundle version %d is newer than this build supports (%d)", doc.Version, bundleVersion)
+	}
+
+	profiles := make([]Profile, 0, len(doc.Profiles))
+	for _, e := range doc.Profiles {
+		p := portable(e.Profile)
+		p.AccessToken = e.Secrets.AccessToken
+		p.RefreshToken = e.Secrets.RefreshToken
+		p.ExpiryTimestamp = e.Secrets.ExpiryTimestamp
+		p.ProxyUser = e.Secrets.ProxyUser
+		p.ProxyPass = e.Secrets.ProxyPass
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// portable drops everything bound to the local master key
+func portable(p Profile) Profile {
+	p.EncryptedBlob = nil
+	p.WrappedKey = nil
+	p.KeyID = ""
+	p.dataKey = nil
+	p.sealedHash = [len(p.sealedHash)]byte{}
+	p.secretState = SecretsNone
+	p.secretErr = nil
+	return p
+}
+
+// Import adds profiles (from ReadBundle) to the store in one atomic update,
+// encrypting their secrets under the local master key. policy decides what
+// happens when a profile name already exists.
+func (s *Store) Import(profiles []Profile, policy ConflictPolicy) ([]ImportResult, error) {
+	var results []ImportResult
+
+	err := s.Transact(func(existing map[string]Profile) error {
+		results = results[:0]
+
+		ids := make(map[string]string, len(existing))
+		for name, p := range existing {
+			ids[p.ID] = name
+		}
+
+		for _, p := range profiles {
+			result := ImportResult{Name: p.Name}
+			_, taken := existing[p.Name]
+
+			switch {
+			case !taken:
+				result.Action = "added"
+			case policy == ConflictSkip:
+				result.Action = "skipped"
+				results = append(results, result)
+				continue
+			case policy == ConflictOverwrite:
+				delete(ids, existing[p.Name].ID)
+				result.Action = "overwritten"
+			case policy == ConflictRename:
+				p.Name = freeName(existing, p.Name)
+				p.ID = ""
+				result.Action = "renamed"
+			default:
+				return fmt.Errorf("unknown conflict policy %q", policy)
+			}
+
+			// The same profile imported twice under different names must not share an ID
+			if other, ok := ids[p.ID]; ok && p.ID != "" && other != p.Name {
+				p.ID = uuid.NewString()
+			}
+
+			existing[p.Name] = p
+			if p.ID != "" {
+				ids[p.ID] = p.Name
+			}
+			result.ImportedAs = p.Name
+			results = append(results, result)
+		}
+		return nil
+	})
+	return results, err
+}
+
+// freeName returns name with the first numeric suffix not used in profiles
+func freeName(profiles map[string]Profile, name string) string {
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s-%d", name, i)
+		if _, taken := profiles[candidate]; !taken {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestBundle_RoundTripAndConflicts(t *testing.T) {
+	source := newTestStore(t)
+	for _, p := range []Profile{
+		{Name: "alice", Email: "alice@example.com", ProxyHost: "proxy", ProxyUser: "u", ProxyPass: "p", AccessToken: "a1", RefreshToken: "r1"},
+		{Name: "bob", Email: "bob@example.com", AccessToken: "a2", RefreshToken: "r2", ExpiryTimestamp: 42},
+	} {
+		if err := source.AddProfile(p); err != nil {
+			t.Fatalf("AddProfile failed: %v", err)
+		}
+	}
+
+	recipient, err := age.NewScryptRecipient("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient.SetWorkFactor(10)
+
+	var bundle bytes.Buffer
+	profiles := []Profile{source.Profiles["alice"], source.Profiles["bob"]}
+	if err := WriteBundle(&bundle, profiles, recipient); err != nil {
+		t.Fatalf("WriteBundle failed: %v", err)
+	}
+	if strings.Contains(bundle.String(), "r1") || strings.Contains(bundle.String(), "alice@") {
+		t.Fatalf("Bundle is not encrypted")
+	}
+
+	wrong, _ := age.NewScryptIdentity("wrong")
+	if _, err := ReadBundle(bytes.NewReader(bundle.Bytes()), wrong); err == nil {
+		t.Fatalf("Expected a wrong passphrase to fail")
+	}
+	identity, _ := age.NewScryptIdentity("correct horse")
+	imported, err := ReadBundle(bytes.NewReader(bundle.Bytes()), identity)
+	if err != nil {
+		t.Fatalf("ReadBundle failed: %v", err)
+	}
+
+	target := NewStore(source.path + ".target")
+	if err := target.AddProfile(Profile{Name: "bob", Email: "local-bob@example.com", AccessToken: "local"}); err != nil {
+		t.Fatalf("AddProfile failed: %v", err)
+	}
+
+	results, err := target.Import(imported, ConflictSkip)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if len(results) != 2 || results[0].Action != "added" || results[1].Action != "skipped" {
+		t.Errorf("Unexpected results: %+v", results)
+	}
+
+	results, err = target.Import(imported, ConflictRename)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if results[1].ImportedAs != "bob-2" {
+		t.Errorf("Expected bob to be renamed to bob-2, got %+v", results[1])
+	}
+
+	if _, err := target.Import(imported[1:], ConflictOverwrite); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	reloaded := NewStore(target.path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	alice, _ := reloaded.GetProfile("alice")
+	if alice.ProxyPass != "p" || alice.RefreshToken != "r1" || alice.ID != source.Profiles["alice"].ID {
+		t.Errorf("Unexpected alice: %+v", alice)
+	}
+	bob, _ := reloaded.GetProfile("bob")
+	bob2, _ := reloaded.GetProfile("bob-2")
+	if bob.Email != "bob@example.com" || bob.ExpiryTimestamp != 42 || bob2.RefreshToken != "r2" {
+		t.Errorf("Unexpected bob %+v / bob-2 %+v", bob, bob2)
+	}
+	if bob.ID == bob2.ID {
+		t.Errorf("Renamed copy shares the ID %s", bob.ID)
+	}
+}
+
+func TestBundle_X25519Recipient(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bundle bytes.Buffer
+	if err := WriteBundle(&bundle, []Profile{{Name: "carol", RefreshToken: "r"}}, identity.Recipient()); err != nil {
+		t.Fatalf("WriteBundle failed: %v", err)
+	}
+	profiles, err := ReadBundle(&bundle, identity)
+	if err != nil {
+		t.Fatalf("ReadBundle failed: %v", err)
+	}
+	if len(profiles) != 1 || profiles[0].RefreshToken != "r" {
+		t.Errorf("Unexpected profiles: %+v", profiles)
+	}
+}
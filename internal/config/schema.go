@@ -0,0 +1,134 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// SchemaVersion is the profiles.json format this build writes.
+//
+//	1  unversioned map of profile name to Profile
+//	2  {"version": 2, "profiles": [...]} with a UUID per profile
+const SchemaVersion = 2
+
+// storeDocument is the on-disk layout of profiles.json
+type storeDocument struct {
+	Version  int       `json:"version"`
+	Profiles []Profile `json:"profiles"`
+}
+
+// storedDocument is storeDocument as it is written
+type storedDocument struct {
+	Version  int             `json:"version"`
+	Profiles []storedProfile `json:"profiles"`
+}
+
+// storedProfile adds the plaintext proxy credentials that only a locked
+// profile from an older file still carries; they stay empty otherwise
+type storedProfile struct {
+	Profile
+	ProxyUser string `json:"proxy_user,omitempty"`
+	ProxyPass string `json:"proxy_pass,omitempty"`
+}
+
+// migration upgrades the raw document from version To-1 to version To.
+// Migrations work on generic JSON so they keep fields later code interprets
+// (such as plaintext proxy credentials) and never depend on the current Profile.
+type migration struct {
+	To      int
+	Migrate func(doc map[string]interface{}) (map[string]interface{}, error)
+}
+
+// migrations must stay sorted by To and cover every version up to SchemaVersion
+var migrations = []migration{
+	{To: 2, Migrate: migrateToDocument},
+}
+
+// legacyIDNamespace derives the IDs of profiles from version 1 files
+var legacyIDNamespace = uuid.MustParse("5b0d4c1e-8f3a-4e1b-9c57-2a6d0e9f4b83")
+
+// migrateToDocument turns the name-keyed map into a versioned document and
+// gives every profile a stable ID. The ID is derived from the profile's name,
+// so a file that cannot be rewritten yet (a locked profile) hands out the same
+// IDs on every load.
+func migrateToDocument(old map[string]interface{}) (map[string]interface{}, error) {
+	names := make([]string, 0, len(old))
+	for name := range old {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	profiles := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		p, ok := old[name].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("profile %q is not an object", name)
+		}
+		if id, _ := p["id"].(string); id == "" {
+			p["id"] = uuid.NewSHA1(legacyIDNamespace, []byte(name)).String()
+		}
+		if n, _ := p["name"].(string); n == "" {
+			p["name"] = name
+		}
+		profiles = append(profiles, p)
+	}
+
+	return map[string]interface{}{"version": 2, "profiles": profiles}, nil
+}
+
+// schemaVersion tells which format raw is in. Version 1 files have no
+// version key, just profile names at the top level.
+func schemaVersion(doc map[string]interface{}) int {
+	v, ok := doc["version"].(float64)
+	if !ok {
+		return 1
+	}
+	return int(v)
+}
+
+// upgradeDocument runs the migrations raw needs and returns the current-format
+// document, plus the version it started from.
+func upgradeDocument(raw []byte) ([]byte, int, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, 0, err
+	}
+
+	from := schemaVersion(doc)
+	if from > SchemaVersion {
+		return nil, from, fmt.Errorf("profiles.json has schema version %d, this build only knows up to %d; please upgrade antigravity-cli", from, SchemaVersion)
+	}
+	if from == SchemaVersion {
+		return raw, from, nil
+	}
+
+	for _, m := range migrations {
+		if m.To <= from {
+			continue
+		}
+		var err error
+		if doc, err = m.Migrate(doc); err != nil {
+			return nil, from, fmt.Errorf("migrating profiles.json to version %d: %w", m.To, err)
+		}
+	}
+
+	upgraded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, from, err
+	}
+	return upgraded, from, nil
+}
+
+// backupBeforeMigration keeps a copy of the file as it was before a schema
+// upgrade. An existing backup of the same version is left alone.
+func backupBeforeMigration(path string, version int, raw []byte) error {
+	backupPath := fmt.Sprintf("%s.v%d.bak", path, version)
+	if _, err := os.Stat(backupPath); err == nil {
+		return nil
+	}
+	return writeFileAtomic(backupPath, raw)
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"antigravity-cli/internal/security"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// SecretState says whether a profile's encrypted secrets could be read
+type SecretState int
+
+const (
+	// SecretsNone means the profile has no encrypted blob
+	SecretsNone SecretState = iota
+	// SecretsOK means the blob was decrypted
+	SecretsOK
+	// SecretsLocked means the master key for the blob is unavailable
+	// (keyring locked, wrong passphrase, key from another machine)
+	SecretsLocked
+	// SecretsCorrupted means the key is there but the blob does not decrypt or parse
+	SecretsCorrupted
+)
+
+func (s SecretState) String() string {
+	switch s {
+	case SecretsOK:
+		return "ok"
+	case SecretsLocked:
+		return "locked"
+	case SecretsCorrupted:
+		return "corrupted"
+	default:
+		return "none"
+	}
+}
+
+// ErrSecretsUnreadable is returned when a save would overwrite secrets that could not be decrypted
+var ErrSecretsUnreadable = errors.New("profile secrets could not be decrypted")
+
+// Secrets reports whether the profile's secrets were decrypted on load, and why not
+func (p Profile) Secrets() (SecretState, error) {
+	return p.secretState, p.secretErr
+}
+
+// decryptSecrets unwraps the profile's data key, decrypts EncryptedBlob with
+// it and records the outcome in secretState.
+func (p *Profile) decryptSecrets() (SensitiveData, error) {
+	var sensitive SensitiveData
+
+	fail := func(state SecretState, err error) (SensitiveData, error) {
+		p.secretState = state
+		p.secretErr = err
+		return sensitive, err
+	}
+
+	master, err := security.KeyForID(p.KeyID)
+	if err != nil {
+		return fail(SecretsLocked, err)
+	}
+
+	dataKey := master
+	if len(p.WrappedKey) > 0 {
+		if dataKey, err = security.UnwrapKeyWith(master, p.WrappedKey); err != nil {
+			return fail(SecretsCorrupted, fmt.Errorf("wrapped data key: %w", err))
+		}
+	}
+
+	decrypted, err := security.DecryptWithKey(dataKey, p.EncryptedBlob)
+	if err != nil {
+		if p.KeyID == "" {
+			// Untagged blobs from older versions: most likely a different master key
+			return fail(SecretsLocked, err)
+		}
+		return fail(SecretsCorrupted, err)
+	}
+	if err := json.Unmarshal(decrypted, &sensitive); err != nil {
+		return fail(SecretsCorrupted, fmt.Errorf("decrypted data is not valid: %w", err))
+	}
+
+	if len(p.WrappedKey) > 0 {
+		p.dataKey = dataKey
+	}
+	p.sealedHash = sha256.Sum256(decrypted)
+	p.secretState = SecretsOK
+	p.secretErr = nil
+	return sensitive, nil
+}
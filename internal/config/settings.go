@@ -0,0 +1,364 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// HomeEnv points the CLI at a self-contained directory holding config.yaml
+// and all data files, like --config-dir
+const HomeEnv = "ANTIGRAVITY_HOME"
+
+// Duration is a time.Duration written as "30s" in config.yaml
+type Duration time.Duration
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+func (d Duration) MarshalYAML() (interface{}, error) { return d.String(), nil }
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", node.Value, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Settings are the user-tunable paths and limits from config.yaml.
+// Empty paths mean auto-detection.
+type Settings struct {
+	// DataDir holds profiles.json, key.json and the active profile pointer
+	DataDir string `yaml:"data_dir"`
+
+	IDE struct {
+		Path   string `yaml:"path"`
+		DBPath string `yaml:"db_path"`
+		// InjectMode is "merge" (keep the IDE's other state) or "replace"
+		InjectMode string `yaml:"inject_mode"`
+	} `yaml:"ide"`
+
+	Tunnel struct {
+		SingBoxPath  string   `yaml:"sing_box_path"`
+		PortMin      int      `yaml:"port_min"`
+		PortMax      int      `yaml:"port_max"`
+		ProbeURL     string   `yaml:"probe_url"`
+		IPInfoURL    string   `yaml:"ip_info_url"`
+		ProbeTimeout Duration `yaml:"probe_timeout"`
+	} `yaml:"tunnel"`
+
+	Auth struct {
+		HTTPTimeout Duration `yaml:"http_timeout"`
+	} `yaml:"auth"`
+
+	Session struct {
+		RefreshCheckInterval Duration `yaml:"refresh_check_interval"`
+		// OnEnd is what happens to the IDE sign-in when a session ends:
+		// "restore" the account signed in before it, or "clear" (sign out)
+		OnEnd string `yaml:"on_end"`
+	} `yaml:"session"`
+
+	// Backup limits the IDE database snapshots taken before every change
+	Backup struct {
+		Keep   int      `yaml:"keep"`
+		MaxAge Duration `yaml:"max_age"` // 0 keeps snapshots regardless of age
+	} `yaml:"backup"`
+}
+
+// DefaultSettings returns the built-in values, used for everything config.yaml leaves out
+func DefaultSettings() Settings {
+	var s Settings
+	s.IDE.InjectMode = "merge"
+	s.Tunnel.PortMin = 10000
+	s.Tunnel.PortMax = 20000
+	s.Tunnel.ProbeURL = "http://clients3.google.com/generate_204"
+	s.Tunnel.IPInfoURL = "http://ip-api.com/json"
+	s.Tunnel.ProbeTimeout = Duration(15 * time.Second)
+	s.Auth.HTTPTimeout = Duration(30 * time.Second)
+	s.Session.RefreshCheckInterval = Duration(time.Minute)
+	s.Session.OnEnd = "restore"
+	s.Backup.Keep = 20
+	s.Backup.MaxAge = Duration(30 * 24 * time.Hour)
+	return s
+}
+
+var (
+	settingsMu sync.RWMutex
+	configDir  string
+	// selfContained is set when the config directory was chosen explicitly,
+	// data files then live there too
+	selfContained bool
+	settings      = DefaultSettings()
+)
+
+// InitSettings resolves the config directory (see ConfigDir) and loads config.yaml from it
+func InitSettings(override string) error {
+	settingsMu.Lock()
+	selfContained = override != "" || os.Getenv(HomeEnv) != ""
+	settingsMu.Unlock()
+	return LoadSettings(ConfigDir(override))
+}
+
+// LoadSettings reads config.yaml from dir and makes it the settings every package uses.
+func LoadSettings(dir string) error {
+	s := DefaultSettings()
+	path := filepath.Join(dir, "config.yaml")
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err == nil {
+		if err := yaml.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+	if err := s.validate(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	settingsMu.Lock()
+	configDir = dir
+	settings = s
+	settingsMu.Unlock()
+	return nil
+}
+
+func (s *Settings) validate() error {
+	if s.Tunnel.PortMin < 1 || s.Tunnel.PortMax > 65535 || s.Tunnel.PortMin > s.Tunnel.PortMax {
+		return fmt.Errorf("invalid tunnel port range %d-%d", s.Tunnel.PortMin, s.Tunnel.PortMax)
+	}
+	for _, d := range []Duration{s.Tunnel.ProbeTimeout, s.Auth.HTTPTimeout, s.Session.RefreshCheckInterval} {
+		if d <= 0 {
+			return fmt.Errorf("durations must be positive, got %s", d)
+		}
+	}
+	if s.IDE.InjectMode != "merge" && s.IDE.InjectMode != "replace" {
+		return fmt.Errorf("ide.inject_mode must be merge or replace, got %q", s.IDE.InjectMode)
+	}
+	if s.Session.OnEnd != "restore" && s.Session.OnEnd != "clear" {
+		return fmt.Errorf("session.on_end must be restore or clear, got %q", s.Session.OnEnd)
+	}
+	if s.Backup.Keep < 1 || s.Backup.MaxAge < 0 {
+		return fmt.Errorf("backup.keep must be at least 1 and backup.max_age not negative")
+	}
+	return nil
+}
+
+// Current returns the loaded settings
+func Current() Settings {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return settings
+}
+
+// ConfigDir resolves the directory holding config.yaml: override (from
+// --config-dir) first, then ANTIGRAVITY_HOME, then
+// $XDG_CONFIG_HOME/antigravity-cli (~/.config/antigravity-cli).
+func ConfigDir(override string) string {
+	if override != "" {
+		return expandHome(override)
+	}
+	if home := os.Getenv(HomeEnv); home != "" {
+		return expandHome(home)
+	}
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "antigravity-cli")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "antigravity-cli")
+}
+
+// DataDir returns where profiles and keys live. Without data_dir in
+// config.yaml it is ~/.antigravity-cli, or the config directory itself when
+// that was chosen with --config-dir or ANTIGRAVITY_HOME.
+func DataDir() string {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+
+	if settings.DataDir != "" {
+		return expandHome(settings.DataDir)
+	}
+	if selfContained && configDir != "" {
+		return configDir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".antigravity-cli")
+}
+
+// BackupDir returns where IDE database snapshots are kept
+func BackupDir() string {
+	return filepath.Join(DataDir(), "db-backups")
+}
+
+// StorePath returns the path of profiles.json
+func StorePath() string {
+	return filepath.Join(DataDir(), "profiles.json")
+}
+
+// KeyConfigPath returns the path of key.json
+func KeyConfigPath() string {
+	return filepath.Join(DataDir(), "key.json")
+}
+
+// SettingsPath returns the path of config.yaml
+func SettingsPath() string {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	dir := configDir
+	if dir == "" {
+		dir = ConfigDir("")
+	}
+	return filepath.Join(dir, "config.yaml")
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, path[1:])
+	}
+	return path
+}
+
+// SettingKeys lists the dotted keys accepted by GetSetting and SetSetting
+func SettingKeys() []string {
+	var keys []string
+	walkSettings(func(key string, _ []int) {
+		keys = append(keys, key)
+	})
+	sort.Strings(keys)
+	return keys
+}
+
+// GetSetting returns the effective value of a dotted key such as "tunnel.port_min"
+func GetSetting(key string) (string, error) {
+	index, err := settingIndex(key)
+	if err != nil {
+		return "", err
+	}
+	s := Current()
+	return fmt.Sprint(reflect.ValueOf(s).FieldByIndex(index).Interface()), nil
+}
+
+// SetSetting stores value for a dotted key in config.yaml, keeping the rest
+// of the file, and reloads the settings
+func SetSetting(key, value string) error {
+	index, err := settingIndex(key)
+	if err != nil {
+		return err
+	}
+
+	// Parse the value with the field's type so config.yaml never holds garbage
+	var typed interface{}
+	switch field := reflect.TypeOf(Settings{}).FieldByIndex(index); field.Type {
+	case reflect.TypeOf(Duration(0)):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid duration %q", key, value)
+		}
+		typed = Duration(d).String()
+	case reflect.TypeOf(0):
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid number %q", key, value)
+		}
+		typed = n
+	default:
+		typed = value
+	}
+
+	path := SettingsPath()
+	doc := make(map[string]interface{})
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	parts := strings.Split(key, ".")
+	node := doc
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := node[part].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			node[part] = child
+		}
+		node = child
+	}
+	node[parts[len(parts)-1]] = typed
+
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	// Validate before writing, a bad port range would break every command
+	check := DefaultSettings()
+	if err := yaml.Unmarshal(out, &check); err != nil {
+		return err
+	}
+	if err := check.validate(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, out); err != nil {
+		return err
+	}
+	return LoadSettings(filepath.Dir(path))
+}
+
+// ShowSettings renders the effective settings as YAML
+func ShowSettings() (string, error) {
+	out, err := yaml.Marshal(Current())
+	return string(out), err
+}
+
+func settingIndex(key string) ([]int, error) {
+	var found []int
+	walkSettings(func(k string, index []int) {
+		if k == key {
+			found = index
+		}
+	})
+	if found == nil {
+		return nil, errors.New("unknown setting " + strconv.Quote(key) + " (see 'config show')")
+	}
+	return found, nil
+}
+
+// walkSettings calls fn for every leaf field of Settings with its dotted yaml key
+func walkSettings(fn func(key string, index []int)) {
+	var walk func(t reflect.Type, prefix string, index []int)
+	walk = func(t reflect.Type, prefix string, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			key := prefix + name
+			fieldIndex := append(append([]int{}, index...), i)
+			if field.Type.Kind() == reflect.Struct {
+				walk(field.Type, key+".", fieldIndex)
+				continue
+			}
+			fn(key, fieldIndex)
+		}
+	}
+	walk(reflect.TypeOf(Settings{}), "", nil)
+}
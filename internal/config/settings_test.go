@@ -0,0 +1,67 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSettings_SetGetAndDataDir(t *testing.T) {
+	dir := t.TempDir()
+	t.Cleanup(func() {
+		settingsMu.Lock()
+		configDir, selfContained, settings = "", false, DefaultSettings()
+		settingsMu.Unlock()
+	})
+
+	if err := InitSettings(dir); err != nil {
+		t.Fatalf("InitSettings failed: %v", err)
+	}
+	if StorePath() != filepath.Join(dir, "profiles.json") {
+		t.Errorf("--config-dir should hold the data files too, got %s", StorePath())
+	}
+
+	if err := SetSetting("tunnel.port_max", "30000"); err != nil {
+		t.Fatalf("SetSetting failed: %v", err)
+	}
+	if err := SetSetting("tunnel.probe_timeout", "5s"); err != nil {
+		t.Fatalf("SetSetting failed: %v", err)
+	}
+	if err := SetSetting("tunnel.port_min", "40000"); err == nil {
+		t.Errorf("Expected an inverted port range to be rejected")
+	}
+	if err := SetSetting("session.on_end", "forget"); err == nil {
+		t.Errorf("Expected an unknown session.on_end to be rejected")
+	}
+	if err := SetSetting("tunnel.nope", "1"); err == nil {
+		t.Errorf("Expected an unknown key to be rejected")
+	}
+
+	if got := Current().Tunnel.ProbeTimeout; time.Duration(got) != 5*time.Second {
+		t.Errorf("Expected probe timeout 5s, got %s", got)
+	}
+	if v, _ := GetSetting("tunnel.port_max"); v != "30000" {
+		t.Errorf("Expected port_max 30000, got %s", v)
+	}
+
+	// Reloading from disk gives the same result, defaults stay out of the file
+	raw, _ := os.ReadFile(filepath.Join(dir, "config.yaml"))
+	if strings.Contains(string(raw), "port_min") {
+		t.Errorf("Defaults written to config.yaml:\n%s", raw)
+	}
+	if err := LoadSettings(dir); err != nil {
+		t.Fatalf("LoadSettings failed: %v", err)
+	}
+	if Current().Tunnel.PortMax != 30000 || Current().Tunnel.PortMin != 10000 {
+		t.Errorf("Unexpected settings after reload: %+v", Current().Tunnel)
+	}
+
+	if err := SetSetting("data_dir", filepath.Join(dir, "data")); err != nil {
+		t.Fatalf("SetSetting failed: %v", err)
+	}
+	if KeyConfigPath() != filepath.Join(dir, "data", "key.json") {
+		t.Errorf("data_dir not applied: %s", KeyConfigPath())
+	}
+}
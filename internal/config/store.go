@@ -2,16 +2,32 @@ package config
 
 import (
 	"antigravity-cli/internal/security"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"sync"
+
+	"github.com/google/uuid"
 )
 
 type SensitiveData struct {
 	AccessToken     string `json:"access_token"`
 	RefreshToken    string `json:"refresh_token"`
 	ExpiryTimestamp int64  `json:"expiry_timestamp"`
+	ProxyUser       string `json:"proxy_user,omitempty"`
+	ProxyPass       string `json:"proxy_pass,omitempty"`
+}
+
+// legacyProxyCredentials picks up proxy credentials that older versions
+// wrote in plaintext next to the encrypted blob.
+type legacyProxyCredentials struct {
+	ProxyUser string `json:"proxy_user"`
+	ProxyPass string `json:"proxy_pass"`
 }
 
 type Profile struct {
@@ -19,22 +35,49 @@ type Profile struct {
 	Name  string `json:"name"`
 	Email string `json:"email"`
 
+	// Google account identity, refreshed from userinfo on every login
+	GoogleID    string `json:"google_id,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+
 	// SensitiveData fields are not stored directly in the main JSON
 	AccessToken     string `json:"-"`
 	RefreshToken    string `json:"-"`
 	ExpiryTimestamp int64  `json:"-"`
 
-	// EncryptedBlob stores the encrypted SensitiveData
+	// EncryptedBlob stores the SensitiveData, encrypted with the profile's data key
 	EncryptedBlob []byte `json:"encrypted_blob"`
+	// WrappedKey is the data key encrypted with the master key. Blobs from
+	// before envelope encryption have none and use the master key directly.
+	WrappedKey []byte `json:"wrapped_key,omitempty"`
+	// KeyID identifies the master key that wrapped the data key
+	KeyID string `json:"key_id,omitempty"`
+
+	// dataKey and sealedHash remember what EncryptedBlob holds, so saving an
+	// unchanged profile keeps its ciphertext instead of re-encrypting it
+	dataKey    []byte
+	sealedHash [sha256.Size]byte
+
+	// secretState and secretErr record whether EncryptedBlob could be read
+	secretState SecretState
+	secretErr   error
+	// legacyProxy holds plaintext proxy credentials of a profile whose blob
+	// could not be read; they are written back as they were until it can be
+	legacyProxy legacyProxyCredentials
 
 	// Network settings
 	ProxyScheme string `json:"proxy_scheme"` // socks5, http
 	ProxyHost   string `json:"proxy_host"`
 	ProxyPort   int    `json:"proxy_port"`
-	ProxyUser   string `json:"proxy_user"`
-	ProxyPass   string `json:"proxy_pass"`
+
+	// Proxy credentials are sensitive too and live in EncryptedBlob
+	ProxyUser string `json:"-"`
+	ProxyPass string `json:"-"`
 
 	UseSystemTunnel bool `json:"use_system_tunnel"`
+
+	// RevokedAt is set when the profile's grant was revoked at Google (logout)
+	RevokedAt int64 `json:"revoked_at,omitempty"`
 }
 
 type Store struct {
@@ -50,94 +93,450 @@ func NewStore(path string) *Store {
 	}
 }
 
+// ErrProfileNotFound is returned by Update and RemoveProfile for unknown profiles
+var ErrProfileNotFound = errors.New("profile not found")
+
+// ErrProfileExists is returned by RenameProfile and CloneProfile when the new name is taken
+var ErrProfileExists = errors.New("profile already exists")
+
 func (s *Store) Load() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	unlock, err := s.lockFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	migrate, err := s.loadNoLock()
+	if err != nil {
+		return err
+	}
+	if migrate {
+		return s.saveNoLock()
+	}
+	return nil
+}
+
+// loadNoLock re-reads the file into s.Profiles, upgrading older schema
+// versions in memory. It reports whether the file is in an old format and
+// should be rewritten.
+func (s *Store) loadNoLock() (bool, error) {
 	data, err := os.ReadFile(s.path)
 	if os.IsNotExist(err) {
-		return nil
+		s.Profiles = make(map[string]Profile)
+		return false, nil
 	}
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	if err := json.Unmarshal(data, &s.Profiles); err != nil {
-		return err
+	upgraded, fromVersion, err := upgradeDocument(data)
+	if err != nil {
+		return false, err
+	}
+	migrate := fromVersion < SchemaVersion
+	if migrate {
+		if err := backupBeforeMigration(s.path, fromVersion, data); err != nil {
+			return false, fmt.Errorf("failed to back up profiles.json before migration: %w", err)
+		}
+	}
+
+	var doc storeDocument
+	if err := json.Unmarshal(upgraded, &doc); err != nil {
+		return false, err
+	}
+	var legacyDoc struct {
+		Profiles []legacyProxyCredentials `json:"profiles"`
+	}
+	if err := json.Unmarshal(upgraded, &legacyDoc); err != nil {
+		return false, err
+	}
+
+	profiles := make(map[string]Profile, len(doc.Profiles))
+	legacy := make(map[string]legacyProxyCredentials, len(doc.Profiles))
+	for i, p := range doc.Profiles {
+		if _, dup := profiles[p.Name]; dup {
+			return false, fmt.Errorf("profiles.json has two profiles named %q", p.Name)
+		}
+		profiles[p.Name] = p
+		legacy[p.Name] = legacyDoc.Profiles[i]
 	}
 
 	// Decrypt sensitive data for all profiles
-	for name, p := range s.Profiles {
+	undecryptable := false
+	for name, p := range profiles {
 		if len(p.EncryptedBlob) > 0 {
-			decrypted, err := security.Decrypt(p.EncryptedBlob)
+			sensitive, err := p.decryptSecrets()
 			if err != nil {
+				// Keep the profile, with its blob untouched, so it can be reported and recovered
+				undecryptable = true
+				p.legacyProxy = legacy[name]
+				profiles[name] = p
 				continue
 			}
+			p.AccessToken = sensitive.AccessToken
+			p.RefreshToken = sensitive.RefreshToken
+			p.ExpiryTimestamp = sensitive.ExpiryTimestamp
+			p.ProxyUser = sensitive.ProxyUser
+			p.ProxyPass = sensitive.ProxyPass
+		}
 
-			var sensitive SensitiveData
-			if err := json.Unmarshal(decrypted, &sensitive); err == nil {
-				p.AccessToken = sensitive.AccessToken
-				p.RefreshToken = sensitive.RefreshToken
-				p.ExpiryTimestamp = sensitive.ExpiryTimestamp
-				s.Profiles[name] = p
+		// Move plaintext proxy credentials from older files into the encrypted blob
+		if old, ok := legacy[name]; ok && (old.ProxyUser != "" || old.ProxyPass != "") {
+			if p.ProxyUser == "" && p.ProxyPass == "" {
+				p.ProxyUser = old.ProxyUser
+				p.ProxyPass = old.ProxyPass
 			}
+			migrate = true
 		}
+		profiles[name] = p
 	}
+	s.Profiles = profiles
 
-	return nil
+	// Rewrite the file in the current format and without plaintext credentials.
+	// Skipped if any blob could not be decrypted, its plaintext credentials
+	// would be lost.
+	return migrate && !undecryptable, nil
 }
 
-func (s *Store) AddProfile(p Profile) error {
+// Transact re-reads the store under an exclusive cross-process lock, lets fn
+// change the profiles and writes the result back. Nothing is written if fn
+// returns an error. Use it instead of Load/modify/Save whenever another
+// process (a second terminal, a session's refresh goroutine) may write too.
+func (s *Store) Transact(fn func(profiles map[string]Profile) error) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	
-	s.Profiles[p.Name] = p
+
+	unlock, err := s.lockFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := s.loadNoLock(); err != nil {
+		return err
+	}
+
+	profiles := make(map[string]Profile, len(s.Profiles))
+	for name, p := range s.Profiles {
+		profiles[name] = p
+	}
+	if err := fn(profiles); err != nil {
+		return err
+	}
+
+	s.Profiles = profiles
 	return s.saveNoLock()
 }
 
+// Update applies fn to the freshest copy of a single profile and saves it.
+func (s *Store) Update(name string, fn func(p *Profile) error) error {
+	return s.Transact(func(profiles map[string]Profile) error {
+		p, ok := profiles[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+		}
+		if err := fn(&p); err != nil {
+			return err
+		}
+		profiles[name] = p
+		return nil
+	})
+}
+
+// AddProfile saves p under its name, replacing a profile of the same name
+func (s *Store) AddProfile(p Profile) error {
+	return s.Transact(func(profiles map[string]Profile) error {
+		profiles[p.Name] = p
+		return nil
+	})
+}
+
+func (s *Store) RemoveProfile(name string) error {
+	return s.Transact(func(profiles map[string]Profile) error {
+		if _, exists := profiles[name]; !exists {
+			return fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+		}
+		delete(profiles, name)
+		return nil
+	})
+}
+
+// RenameProfile changes a profile's name. Its ID, tokens and settings stay
+// as they are, and the active-profile pointer follows the rename.
+func (s *Store) RenameProfile(oldName, newName string) error {
+	if newName == "" {
+		return errors.New("new profile name is empty")
+	}
+	err := s.Transact(func(profiles map[string]Profile) error {
+		p, ok := profiles[oldName]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrProfileNotFound, oldName)
+		}
+		if _, taken := profiles[newName]; taken {
+			return fmt.Errorf("%w: %s", ErrProfileExists, newName)
+		}
+		delete(profiles, oldName)
+		p.Name = newName
+		profiles[newName] = p
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if GetActiveProfileName() == oldName {
+		return SetActiveProfileName(newName)
+	}
+	return nil
+}
+
+// CloneProfile creates newName with the proxy and tunnel settings of srcName.
+// The clone is a separate identity and has no tokens until it logs in.
+func (s *Store) CloneProfile(srcName, newName, email string) (Profile, error) {
+	var clone Profile
+	err := s.Transact(func(profiles map[string]Profile) error {
+		src, ok := profiles[srcName]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrProfileNotFound, srcName)
+		}
+		if _, taken := profiles[newName]; taken {
+			return fmt.Errorf("%w: %s", ErrProfileExists, newName)
+		}
+		if state, err := src.Secrets(); state == SecretsLocked || state == SecretsCorrupted {
+			// The proxy credentials are in the unreadable blob
+			return fmt.Errorf("%w: %s (%v)", ErrSecretsUnreadable, srcName, err)
+		}
+
+		clone = Profile{
+			Name:            newName,
+			Email:           email,
+			ProxyScheme:     src.ProxyScheme,
+			ProxyHost:       src.ProxyHost,
+			ProxyPort:       src.ProxyPort,
+			ProxyUser:       src.ProxyUser,
+			ProxyPass:       src.ProxyPass,
+			UseSystemTunnel: src.UseSystemTunnel,
+			AccessToken:     "pending_auth",
+			RefreshToken:    "pending_auth",
+		}
+		profiles[newName] = clone
+		return nil
+	})
+	return clone, err
+}
+
+// ReEncrypt re-reads the store and re-wraps every profile's data key with key
+// in a single atomic write. It is the middle step of a master key rotation and
+// refuses to run if any blob cannot be decrypted, as that blob would be lost.
+// commit (the last step) runs before the store lock is released, so no other
+// process can seal a blob with the old key in between.
+func (s *Store) ReEncrypt(key []byte, commit func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := s.lockFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := s.loadNoLock(); err != nil {
+		return err
+	}
+	if locked := s.lockedProfilesNoLock(); len(locked) > 0 {
+		return fmt.Errorf("%w: %v, refusing to re-encrypt", ErrSecretsUnreadable, locked)
+	}
+	if err := s.saveWithKey(key); err != nil {
+		return err
+	}
+	return commit()
+}
+
 func (s *Store) saveNoLock() error {
+	return s.saveWithKey(nil)
+}
+
+// saveWithKey writes the profiles. Secrets that changed since they were last
+// sealed get encrypted again; data keys are wrapped with key, or with the
+// current master key if key is nil. An explicit key also re-wraps every data
+// key that is not wrapped with it yet.
+func (s *Store) saveWithKey(key []byte) error {
 	profilesToSave := make(map[string]Profile)
 
 	for name, p := range s.Profiles {
+		if p.ID == "" {
+			// The ID stays with the profile through renames
+			p.ID = uuid.NewString()
+		}
+
+		if p.secretState == SecretsLocked || p.secretState == SecretsCorrupted {
+			// Writing secrets here would replace a blob we could not read
+			if p.AccessToken != "" || p.RefreshToken != "" || p.ProxyUser != "" || p.ProxyPass != "" {
+				return fmt.Errorf("%w: %s (%v); remove and re-add the profile to replace it", ErrSecretsUnreadable, name, p.secretErr)
+			}
+			profilesToSave[name] = p
+			continue
+		}
+
+		if p.AccessToken == "" && p.RefreshToken == "" && p.ProxyUser == "" && p.ProxyPass == "" {
+			// Nothing secret to keep (e.g. after logout), drop the blob entirely
+			p.EncryptedBlob = nil
+			p.WrappedKey = nil
+			p.KeyID = ""
+			p.dataKey = nil
+			p.secretState = SecretsNone
+			profilesToSave[name] = p
+			continue
+		}
+
 		sensitive := SensitiveData{
 			AccessToken:     p.AccessToken,
 			RefreshToken:    p.RefreshToken,
 			ExpiryTimestamp: p.ExpiryTimestamp,
+			ProxyUser:       p.ProxyUser,
+			ProxyPass:       p.ProxyPass,
 		}
-		
+
 		jsonData, err := json.Marshal(sensitive)
 		if err != nil {
 			return err
 		}
+		hash := sha256.Sum256(jsonData)
 
-		encrypted, err := security.Encrypt(jsonData)
-		if err != nil {
-			return err
+		changed := p.dataKey == nil || len(p.EncryptedBlob) == 0 || hash != p.sealedHash
+		rewrap := p.dataKey == nil || len(p.WrappedKey) == 0 || (key != nil && p.KeyID != security.KeyID(key))
+
+		if changed {
+			if p.dataKey == nil {
+				if p.dataKey, err = security.NewDataKey(); err != nil {
+					return err
+				}
+			}
+			if p.EncryptedBlob, err = security.EncryptWithKey(p.dataKey, jsonData); err != nil {
+				return err
+			}
+			p.sealedHash = hash
+			p.secretState = SecretsOK
+		}
+
+		if rewrap {
+			if key == nil {
+				p.WrappedKey, p.KeyID, err = security.WrapKey(p.dataKey)
+			} else {
+				p.WrappedKey, p.KeyID, err = security.WrapKeyWith(key, p.dataKey)
+			}
+			if err != nil {
+				return err
+			}
 		}
 
-		p.EncryptedBlob = encrypted
 		profilesToSave[name] = p
 	}
 
-	data, err := json.MarshalIndent(profilesToSave, "", "  ")
+	doc := storedDocument{Version: SchemaVersion, Profiles: make([]storedProfile, 0, len(profilesToSave))}
+	for _, p := range profilesToSave {
+		doc.Profiles = append(doc.Profiles, storedProfile{
+			Profile:   p,
+			ProxyUser: p.legacyProxy.ProxyUser,
+			ProxyPass: p.legacyProxy.ProxyPass,
+		})
+	}
+	sort.Slice(doc.Profiles, func(i, j int) bool { return doc.Profiles[i].Name < doc.Profiles[j].Name })
+
+	data, err := json.MarshalIndent(doc, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	dir := filepath.Dir(s.path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	if err := writeFileAtomic(s.path, data); err != nil {
 		return err
 	}
-
-	return os.WriteFile(s.path, data, 0644)
+	s.Profiles = profilesToSave
+	return nil
 }
 
+// Save writes the in-memory profiles as they are. Prefer Update/Transact,
+// Save overwrites whatever other processes wrote since the last Load.
 func (s *Store) Save() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+
+	unlock, err := s.lockFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	return s.saveNoLock()
 }
 
+// lockFile takes the cross-process lock guarding the store file
+func (s *Store) lockFile() (func(), error) {
+	// Owner-only: the directory holds encrypted credentials and account metadata
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	os.Chmod(dir, 0700)
+
+	unlock, err := lockFile(s.path + ".lock")
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock profile store: %w", err)
+	}
+	return unlock, nil
+}
+
+// writeFileAtomic writes data to a temp file next to path and renames it over
+// path, so readers never see a half-written file even if we crash mid-write.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op after a successful rename
+
+	if err := tmp.Chmod(0600); err != nil && runtime.GOOS != "windows" {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// UnreadableProfiles returns the names of profiles whose secrets could not be
+// decrypted on the last load
+func (s *Store) UnreadableProfiles() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lockedProfilesNoLock()
+}
+
+func (s *Store) lockedProfilesNoLock() []string {
+	var names []string
+	for name, p := range s.Profiles {
+		if p.secretState == SecretsLocked || p.secretState == SecretsCorrupted {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (s *Store) GetProfile(name string) (Profile, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
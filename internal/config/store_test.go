@@ -0,0 +1,571 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"antigravity-cli/internal/security"
+
+	"github.com/zalando/go-keyring"
+)
+
+func newTestStore(t *testing.T) *Store {
+	keyring.MockInit()
+	return NewStore(filepath.Join(t.TempDir(), "cli", "profiles.json"))
+}
+
+// readProfiles returns the profiles as they are on disk, without decrypting
+func readProfiles(t *testing.T, path string) map[string]Profile {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read store: %v", err)
+	}
+	var doc storeDocument
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("Failed to parse store: %v", err)
+	}
+	profiles := make(map[string]Profile)
+	for _, p := range doc.Profiles {
+		profiles[p.Name] = p
+	}
+	return profiles
+}
+
+// writeProfiles replaces the file with profiles in the current schema
+func writeProfiles(t *testing.T, path string, profiles map[string]Profile) {
+	t.Helper()
+	doc := storeDocument{Version: SchemaVersion}
+	for _, p := range profiles {
+		doc.Profiles = append(doc.Profiles, p)
+	}
+	raw, _ := json.Marshal(doc)
+	if err := os.WriteFile(path, raw, 0600); err != nil {
+		t.Fatalf("Failed to write store: %v", err)
+	}
+}
+
+func TestStore_ProxyCredentialsEncrypted(t *testing.T) {
+	store := newTestStore(t)
+
+	err := store.AddProfile(Profile{
+		Name:         "alice",
+		Email:        "alice@example.com",
+		ProxyHost:    "proxy.example.com",
+		ProxyUser:    "proxyuser",
+		ProxyPass:    "s3cret",
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+	})
+	if err != nil {
+		t.Fatalf("AddProfile failed: %v", err)
+	}
+
+	raw, err := os.ReadFile(store.path)
+	if err != nil {
+		t.Fatalf("Failed to read store: %v", err)
+	}
+	if strings.Contains(string(raw), "s3cret") || strings.Contains(string(raw), "proxyuser") {
+		t.Errorf("Proxy credentials written in plaintext:\n%s", raw)
+	}
+
+	if runtime.GOOS != "windows" {
+		info, _ := os.Stat(store.path)
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected store mode 0600, got %o", info.Mode().Perm())
+		}
+		info, _ = os.Stat(filepath.Dir(store.path))
+		if info.Mode().Perm() != 0700 {
+			t.Errorf("Expected store dir mode 0700, got %o", info.Mode().Perm())
+		}
+	}
+
+	reloaded := NewStore(store.path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	p, _ := reloaded.GetProfile("alice")
+	if p.ProxyUser != "proxyuser" || p.ProxyPass != "s3cret" || p.AccessToken != "access" {
+		t.Errorf("Unexpected profile after reload: %+v", p)
+	}
+}
+
+func TestStore_MigratesPlaintextProxyCredentials(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.AddProfile(Profile{Name: "bob", AccessToken: "access", RefreshToken: "refresh"}); err != nil {
+		t.Fatalf("AddProfile failed: %v", err)
+	}
+
+	// Rewrite the file the way older versions did: a bare map, with plaintext credentials
+	var onDisk map[string]map[string]interface{}
+	raw, _ := json.Marshal(readProfiles(t, store.path))
+	json.Unmarshal(raw, &onDisk)
+	onDisk["bob"]["proxy_user"] = "legacyuser"
+	onDisk["bob"]["proxy_pass"] = "legacypass"
+	raw, _ = json.Marshal(onDisk)
+	os.WriteFile(store.path, raw, 0644)
+
+	migrated := NewStore(store.path)
+	if err := migrated.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	p, _ := migrated.GetProfile("bob")
+	if p.ProxyUser != "legacyuser" || p.ProxyPass != "legacypass" || p.AccessToken != "access" {
+		t.Errorf("Unexpected profile after migration: %+v", p)
+	}
+
+	raw, _ = os.ReadFile(store.path)
+	if strings.Contains(string(raw), "legacypass") {
+		t.Errorf("Plaintext credentials still on disk after migration:\n%s", raw)
+	}
+}
+
+func TestStore_ConcurrentUpdatesAreNotLost(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.AddProfile(Profile{Name: "carol", AccessToken: "access"}); err != nil {
+		t.Fatalf("AddProfile failed: %v", err)
+	}
+
+	// Separate Store instances behave like separate CLI processes
+	const writers, perWriter = 4, 10
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := NewStore(store.path)
+			for j := 0; j < perWriter; j++ {
+				err := s.Update("carol", func(p *Profile) error {
+					p.ExpiryTimestamp++
+					return nil
+				})
+				if err != nil {
+					t.Errorf("Update failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	final := NewStore(store.path)
+	if err := final.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	p, _ := final.GetProfile("carol")
+	if p.ExpiryTimestamp != writers*perWriter {
+		t.Errorf("Expected %d updates, got %d", writers*perWriter, p.ExpiryTimestamp)
+	}
+}
+
+func TestStore_UpdateErrorWritesNothing(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.AddProfile(Profile{Name: "dave", Email: "dave@example.com"}); err != nil {
+		t.Fatalf("AddProfile failed: %v", err)
+	}
+
+	err := store.Update("dave", func(p *Profile) error {
+		p.Email = "changed@example.com"
+		return errors.New("abort")
+	})
+	if err == nil {
+		t.Fatalf("Expected Update to fail")
+	}
+
+	reloaded := NewStore(store.path)
+	reloaded.Load()
+	if p, _ := reloaded.GetProfile("dave"); p.Email != "dave@example.com" {
+		t.Errorf("Aborted update was written: %s", p.Email)
+	}
+	if err := store.Update("nobody", func(p *Profile) error { return nil }); !errors.Is(err, ErrProfileNotFound) {
+		t.Errorf("Expected ErrProfileNotFound, got %v", err)
+	}
+}
+
+func TestStore_KeyRotationSurvivesInterruption(t *testing.T) {
+	store := newTestStore(t)
+	if err := security.Init(filepath.Join(filepath.Dir(store.path), "key.json")); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if err := store.AddProfile(Profile{Name: "erin", AccessToken: "access", RefreshToken: "refresh"}); err != nil {
+		t.Fatalf("AddProfile failed: %v", err)
+	}
+	oldID, _ := security.CurrentKeyID()
+
+	newKey, resumed, err := security.BeginRotation()
+	if err != nil || resumed {
+		t.Fatalf("BeginRotation failed: %v (resumed %v)", err, resumed)
+	}
+	crash := errors.New("crash")
+	if err := store.ReEncrypt(newKey, func() error { return crash }); !errors.Is(err, crash) {
+		t.Fatalf("Expected the commit error, got %v", err)
+	}
+
+	// Crash before CommitRotation: blobs use the pending key, the provider still has the old one
+	interrupted := NewStore(store.path)
+	if err := interrupted.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	p, _ := interrupted.GetProfile("erin")
+	if p.AccessToken != "access" || p.KeyID != security.KeyID(newKey) {
+		t.Errorf("Profile unreadable mid-rotation: %+v", p)
+	}
+
+	resumedKey, resumed, err := security.BeginRotation()
+	if err != nil || !resumed || string(resumedKey) != string(newKey) {
+		t.Fatalf("Expected to resume with the pending key, got resumed=%v err=%v", resumed, err)
+	}
+	if err := security.CommitRotation(newKey); err != nil {
+		t.Fatalf("CommitRotation failed: %v", err)
+	}
+
+	newID, _ := security.CurrentKeyID()
+	if newID == oldID || newID != security.KeyID(newKey) || security.PendingRotation() != "" {
+		t.Errorf("Rotation not committed: old %s, current %s, pending %q", oldID, newID, security.PendingRotation())
+	}
+
+	rotated := NewStore(store.path)
+	if err := rotated.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if p, _ := rotated.GetProfile("erin"); p.RefreshToken != "refresh" {
+		t.Errorf("Profile unreadable after rotation: %+v", p)
+	}
+}
+
+func TestStore_UnchangedProfilesKeepCiphertext(t *testing.T) {
+	store := newTestStore(t)
+	for _, name := range []string{"frank", "grace"} {
+		if err := store.AddProfile(Profile{Name: name, AccessToken: name + "-access"}); err != nil {
+			t.Fatalf("AddProfile failed: %v", err)
+		}
+	}
+	before, _ := store.GetProfile("frank")
+	if len(before.WrappedKey) == 0 {
+		t.Fatalf("Expected a wrapped data key")
+	}
+
+	err := store.Update("grace", func(p *Profile) error {
+		p.AccessToken = "grace-new"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	reloaded := NewStore(store.path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	frank, _ := reloaded.GetProfile("frank")
+	if string(frank.EncryptedBlob) != string(before.EncryptedBlob) || string(frank.WrappedKey) != string(before.WrappedKey) {
+		t.Errorf("Unchanged profile was re-encrypted")
+	}
+	if grace, _ := reloaded.GetProfile("grace"); grace.AccessToken != "grace-new" {
+		t.Errorf("Changed profile not saved: %+v", grace)
+	}
+}
+
+func TestStore_UpgradesLegacyBlobs(t *testing.T) {
+	store := newTestStore(t)
+	blob, _ := json.Marshal(SensitiveData{AccessToken: "legacy-access"})
+	encrypted, err := security.Encrypt(blob)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	raw, _ := json.Marshal(map[string]Profile{"heidi": {Name: "heidi", EncryptedBlob: encrypted}})
+	os.MkdirAll(filepath.Dir(store.path), 0700)
+	os.WriteFile(store.path, raw, 0600)
+
+	if err := store.Update("heidi", func(p *Profile) error { return nil }); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	reloaded := NewStore(store.path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	p, _ := reloaded.GetProfile("heidi")
+	if p.AccessToken != "legacy-access" || len(p.WrappedKey) == 0 {
+		t.Errorf("Legacy blob not upgraded: %+v", p)
+	}
+}
+
+// newBenchStore writes a store with n profiles, about the size of a large team setup
+func newBenchStore(b *testing.B, n int) *Store {
+	keyring.MockInit()
+	store := NewStore(filepath.Join(b.TempDir(), "profiles.json"))
+	err := store.Transact(func(profiles map[string]Profile) error {
+		for i := 0; i < n; i++ {
+			name := fmt.Sprintf("account-%03d", i)
+			profiles[name] = Profile{
+				Name:         name,
+				Email:        name + "@example.com",
+				AccessToken:  strings.Repeat("a", 200),
+				RefreshToken: strings.Repeat("r", 100),
+				ProxyUser:    "user",
+				ProxyPass:    "pass",
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatalf("Failed to create store: %v", err)
+	}
+	return store
+}
+
+func BenchmarkStore_Load(b *testing.B) {
+	store := newBenchStore(b, 150)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := NewStore(store.path).Load(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStore_UpdateOne(b *testing.B) {
+	store := newBenchStore(b, 150)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := store.Update("account-042", func(p *Profile) error {
+			p.ExpiryTimestamp = int64(i)
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestStore_UndecryptableProfilesArePreserved(t *testing.T) {
+	store := newTestStore(t)
+	for _, name := range []string{"ivan", "judy", "mallory"} {
+		if err := store.AddProfile(Profile{Name: name, AccessToken: name + "-access"}); err != nil {
+			t.Fatalf("AddProfile failed: %v", err)
+		}
+	}
+
+	// Damage one blob and tag another with a master key we don't have
+	onDisk := readProfiles(t, store.path)
+	judy := onDisk["judy"]
+	judy.EncryptedBlob[len(judy.EncryptedBlob)-1] ^= 0xff
+	onDisk["judy"] = judy
+	mallory := onDisk["mallory"]
+	mallory.KeyID = "0000000000000000"
+	onDisk["mallory"] = mallory
+	writeProfiles(t, store.path, onDisk)
+
+	loaded := NewStore(store.path)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if state, _ := loaded.Profiles["ivan"].Secrets(); state != SecretsOK {
+		t.Errorf("Expected ivan ok, got %s", state)
+	}
+	if state, err := loaded.Profiles["judy"].Secrets(); state != SecretsCorrupted || err == nil {
+		t.Errorf("Expected judy corrupted, got %s (%v)", state, err)
+	}
+	if state, _ := loaded.Profiles["mallory"].Secrets(); state != SecretsLocked {
+		t.Errorf("Expected mallory locked, got %s", state)
+	}
+	if got := loaded.UnreadableProfiles(); len(got) != 2 || got[0] != "judy" || got[1] != "mallory" {
+		t.Errorf("Unexpected unreadable profiles: %v", got)
+	}
+
+	// Saving other changes must keep the unreadable blobs byte for byte
+	err := loaded.Update("ivan", func(p *Profile) error {
+		p.AccessToken = "ivan-new"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	after := readProfiles(t, store.path)
+	if string(after["judy"].EncryptedBlob) != string(judy.EncryptedBlob) || after["mallory"].KeyID != mallory.KeyID {
+		t.Errorf("Unreadable blobs were rewritten")
+	}
+
+	err = loaded.Update("judy", func(p *Profile) error {
+		p.AccessToken = "overwrite"
+		return nil
+	})
+	if !errors.Is(err, ErrSecretsUnreadable) {
+		t.Errorf("Expected ErrSecretsUnreadable, got %v", err)
+	}
+}
+
+func TestStore_LockedProfileKeepsLegacyProxyCredentials(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.AddProfile(Profile{Name: "oscar", AccessToken: "access"}); err != nil {
+		t.Fatalf("AddProfile failed: %v", err)
+	}
+	sealed := readProfiles(t, store.path)["oscar"]
+
+	// A v1 file: one profile sealed with a master key we don't have and still
+	// carrying plaintext proxy credentials, one without secrets
+	v1 := map[string]map[string]interface{}{
+		"oscar": {
+			"name": "oscar", "encrypted_blob": sealed.EncryptedBlob, "wrapped_key": sealed.WrappedKey,
+			"key_id": "0000000000000000", "proxy_user": "legacyuser", "proxy_pass": "legacypass",
+		},
+		"peggy": {"name": "peggy", "email": "peggy@example.com"},
+	}
+	raw, _ := json.Marshal(v1)
+	os.WriteFile(store.path, raw, 0600)
+
+	loaded := NewStore(store.path)
+	if err := loaded.Update("peggy", func(p *Profile) error { p.Email = "new@example.com"; return nil }); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	raw, _ = os.ReadFile(store.path)
+	var doc struct {
+		Profiles []map[string]interface{} `json:"profiles"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("Failed to parse store: %v", err)
+	}
+	for _, p := range doc.Profiles {
+		if p["name"] == "oscar" && (p["proxy_user"] != "legacyuser" || p["proxy_pass"] != "legacypass") {
+			t.Errorf("Proxy credentials of the locked profile were dropped:\n%s", raw)
+		}
+	}
+}
+
+func TestStore_MigratesUnversionedFile(t *testing.T) {
+	store := newTestStore(t)
+	v1 := `{"old name": {"id": "", "name": "old name", "email": "o@example.com", "encrypted_blob": null}}`
+	os.MkdirAll(filepath.Dir(store.path), 0700)
+	os.WriteFile(store.path, []byte(v1), 0600)
+
+	if err := store.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	p, ok := store.GetProfile("old name")
+	if !ok || p.ID == "" || p.Email != "o@example.com" {
+		t.Fatalf("Unexpected profile after migration: %+v", p)
+	}
+
+	raw, _ := os.ReadFile(store.path)
+	var doc storeDocument
+	if err := json.Unmarshal(raw, &doc); err != nil || doc.Version != SchemaVersion || len(doc.Profiles) != 1 {
+		t.Errorf("File not rewritten in the current schema:\n%s", raw)
+	}
+	if backup, err := os.ReadFile(store.path + ".v1.bak"); err != nil || string(backup) != v1 {
+		t.Errorf("Expected a backup of the original file, got %q (%v)", backup, err)
+	}
+
+	// The ID must survive later saves
+	if err := store.Update("old name", func(p *Profile) error { p.Email = "new@example.com"; return nil }); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if after := readProfiles(t, store.path)["old name"]; after.ID != p.ID {
+		t.Errorf("Profile ID changed from %s to %s", p.ID, after.ID)
+	}
+}
+
+func TestUpgradeDocument_StableIDs(t *testing.T) {
+	v1 := []byte(`{"alpha": {"name": "alpha"}, "beta": {"name": "beta"}}`)
+
+	ids := func() []string {
+		upgraded, from, err := upgradeDocument(v1)
+		if err != nil || from != 1 {
+			t.Fatalf("upgradeDocument failed: %v (from %d)", err, from)
+		}
+		var doc storeDocument
+		json.Unmarshal(upgraded, &doc)
+		var ids []string
+		for _, p := range doc.Profiles {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+
+	first, second := ids(), ids()
+	if len(first) != 2 || first[0] == first[1] {
+		t.Fatalf("Expected two distinct IDs, got %v", first)
+	}
+	if first[0] != second[0] || first[1] != second[1] {
+		t.Errorf("IDs change between loads of an unmigrated file: %v vs %v", first, second)
+	}
+}
+
+func TestStore_AddProfileReplacesExisting(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.AddProfile(Profile{Name: "quinn", Email: "old@example.com", AccessToken: "old"}); err != nil {
+		t.Fatalf("AddProfile failed: %v", err)
+	}
+	if err := store.AddProfile(Profile{Name: "quinn", Email: "new@example.com", AccessToken: "new"}); err != nil {
+		t.Fatalf("AddProfile over an existing name failed: %v", err)
+	}
+
+	reloaded := NewStore(store.path)
+	reloaded.Load()
+	if p, _ := reloaded.GetProfile("quinn"); p.Email != "new@example.com" || p.AccessToken != "new" {
+		t.Errorf("Profile not replaced: %+v", p)
+	}
+}
+
+func TestStore_RejectsNewerSchema(t *testing.T) {
+	store := newTestStore(t)
+	os.MkdirAll(filepath.Dir(store.path), 0700)
+	os.WriteFile(store.path, []byte(`{"version": 99, "profiles": []}`), 0600)
+
+	if err := store.Load(); err == nil {
+		t.Errorf("Expected Load to refuse a newer schema")
+	}
+}
+
+func TestStore_RenameKeepsIdentityAndActivePointer(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store := newTestStore(t)
+	if err := store.AddProfile(Profile{Name: "old", AccessToken: "access", ProxyHost: "proxy", ProxyUser: "u", ProxyPass: "p"}); err != nil {
+		t.Fatalf("AddProfile failed: %v", err)
+	}
+	if err := store.AddProfile(Profile{Name: "other"}); err != nil {
+		t.Fatalf("AddProfile failed: %v", err)
+	}
+	before, _ := store.GetProfile("old")
+	SetActiveProfileName("old")
+
+	if err := store.RenameProfile("old", "other"); !errors.Is(err, ErrProfileExists) {
+		t.Errorf("Expected ErrProfileExists, got %v", err)
+	}
+	if err := store.RenameProfile("old", "new"); err != nil {
+		t.Fatalf("RenameProfile failed: %v", err)
+	}
+
+	reloaded := NewStore(store.path)
+	reloaded.Load()
+	if _, ok := reloaded.GetProfile("old"); ok {
+		t.Errorf("Old name still present")
+	}
+	p, _ := reloaded.GetProfile("new")
+	if p.ID != before.ID || p.AccessToken != "access" || p.Name != "new" {
+		t.Errorf("Unexpected renamed profile: %+v", p)
+	}
+	if active := GetActiveProfileName(); active != "new" {
+		t.Errorf("Active profile pointer is %q", active)
+	}
+
+	clone, err := reloaded.CloneProfile("new", "copy", "copy@example.com")
+	if err != nil {
+		t.Fatalf("CloneProfile failed: %v", err)
+	}
+	reloaded.Load()
+	copied, _ := reloaded.GetProfile("copy")
+	if copied.ID == "" || copied.ID == p.ID || copied.ProxyPass != "p" || copied.Email != "copy@example.com" {
+		t.Errorf("Unexpected clone: %+v", copied)
+	}
+	if clone.AccessToken != "pending_auth" {
+		t.Errorf("Clone should not carry tokens: %+v", clone)
+	}
+}
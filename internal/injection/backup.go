@@ -0,0 +1,248 @@
+package injection
+
+import (
+	"antigravity-cli/internal/config"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CredentialKeys are the ItemTable rows injection, token refresh and logout
+// write. Snapshots cover exactly these, which keeps them small enough to take
+// before every change.
+var CredentialKeys = []string{
+	"antigravityAuthStatus",
+	"antigravityOnboarding",
+	"antigravity.profileUrl",
+	"jetskiStateSync.agentManagerInitState",
+	"google.antigravity",
+}
+
+// ErrSnapshotNotFound is returned by LoadSnapshot for unknown IDs
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// Snapshot is a copy of the credential rows of state.vscdb taken before a change
+type Snapshot struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	DBPath  string    `json:"db_path"`
+	Reason  string    `json:"reason"`
+	// Rows maps each key to its value; nil means the row did not exist
+	Rows map[string]*string `json:"rows"`
+}
+
+// TakeSnapshot saves the credential rows of the database at dbPath to the
+// backup directory and prunes old snapshots.
+func TakeSnapshot(dbPath, reason string) (*Snapshot, error) {
+	rows, err := ReadCredentialRows(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	snap := &Snapshot{
+		Created: time.Now(),
+		DBPath:  dbPath,
+		Reason:  reason,
+		Rows:    rows,
+	}
+
+	if err := snap.save(); err != nil {
+		return nil, fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	pruneSnapshots()
+	return snap, nil
+}
+
+// ReadCredentialRows returns the current values of CredentialKeys, nil for
+// rows that do not exist
+func ReadCredentialRows(dbPath string) (map[string]*string, error) {
+	var rows map[string]*string
+	err := withTx(dbPath, func(tx *sql.Tx) error {
+		rows = make(map[string]*string, len(CredentialKeys))
+		for _, key := range CredentialKeys {
+			var value string
+			err := tx.QueryRow("SELECT value FROM ItemTable WHERE key = ?", key).Scan(&value)
+			switch {
+			case err == sql.ErrNoRows:
+				rows[key] = nil
+			case err != nil:
+				return fmt.Errorf("failed to read %s: %w", key, err)
+			default:
+				rows[key] = &value
+			}
+		}
+		return nil
+	})
+	return rows, err
+}
+
+// KeyChange describes how one row differs between two ReadCredentialRows results
+type KeyChange struct {
+	Key    string
+	Change string // added, deleted, modified
+}
+
+// DiffRows lists the keys whose rows differ, in CredentialKeys order
+func DiffRows(before, after map[string]*string) []KeyChange {
+	var changes []KeyChange
+	for _, key := range CredentialKeys {
+		b, a := before[key], after[key]
+		switch {
+		case b == nil && a == nil:
+		case b == nil:
+			changes = append(changes, KeyChange{Key: key, Change: "added"})
+		case a == nil:
+			changes = append(changes, KeyChange{Key: key, Change: "deleted"})
+		case *b != *a:
+			changes = append(changes, KeyChange{Key: key, Change: "modified"})
+		}
+	}
+	return changes
+}
+
+func (s *Snapshot) save() error {
+	dir := config.BackupDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	// IDs sort by time; a counter keeps two snapshots in the same millisecond apart
+	base := s.Created.Format("20060102-150405.000")
+	for i := 0; ; i++ {
+		s.ID = base
+		if i > 0 {
+			s.ID = fmt.Sprintf("%s-%d", base, i)
+		}
+		data, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(filepath.Join(dir, s.ID+".json"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+}
+
+// Restore writes the snapshot's rows back into the database at dbPath in one
+// transaction, deleting rows that did not exist when it was taken.
+func (s *Snapshot) Restore(dbPath string) error {
+	return withTx(dbPath, func(tx *sql.Tx) error {
+		for key, value := range s.Rows {
+			var err error
+			if value == nil {
+				_, err = tx.Exec("DELETE FROM ItemTable WHERE key = ?", key)
+			} else {
+				_, err = tx.Exec("INSERT OR REPLACE INTO ItemTable (key, value) VALUES (?, ?)", key, *value)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to restore %s: %w", key, err)
+			}
+		}
+		return nil
+	})
+}
+
+// WithSnapshot takes a snapshot of dbPath and runs mutate. If mutate fails
+// after committing part of its work, the snapshot is restored, so a change is
+// applied completely or not at all. A failed transaction (withTx) was already
+// rolled back by SQLite; restoring on top would only revert what the IDE
+// wrote in the meantime, so that error is returned unchanged. A mutate that
+// runs several transactions must not return a later one's error as it is.
+func WithSnapshot(dbPath, reason string, mutate func() error) error {
+	snap, err := TakeSnapshot(dbPath, reason)
+	if err != nil {
+		return fmt.Errorf("failed to back up IDE state, nothing was changed: %w", err)
+	}
+
+	if err := mutate(); err != nil {
+		var txErr *txError
+		if errors.As(err, &txErr) {
+			return txErr.err
+		}
+		if rerr := snap.Restore(dbPath); rerr != nil {
+			return fmt.Errorf("%w (rollback failed too: %v; run 'antigravity db restore %s')", err, rerr, snap.ID)
+		}
+		return fmt.Errorf("%w (IDE state rolled back)", err)
+	}
+	return nil
+}
+
+// ListSnapshots returns all snapshots, newest first
+func ListSnapshots() ([]Snapshot, error) {
+	entries, err := os.ReadDir(config.BackupDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snaps []Snapshot
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		snap, err := LoadSnapshot(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			continue // unreadable files are skipped, not fatal for listing
+		}
+		snaps = append(snaps, *snap)
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].ID > snaps[j].ID })
+	return snaps, nil
+}
+
+// LoadSnapshot reads the snapshot with the given ID
+func LoadSnapshot(id string) (*Snapshot, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("%w: %q", ErrSnapshotNotFound, id)
+	}
+	data, err := os.ReadFile(filepath.Join(config.BackupDir(), id+".json"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("snapshot %s is corrupted: %w", id, err)
+	}
+	snap.ID = id
+	return &snap, nil
+}
+
+// pruneSnapshots applies backup.keep and backup.max_age. Errors are ignored,
+// a failed prune only means a few extra files.
+func pruneSnapshots() {
+	snaps, err := ListSnapshots()
+	if err != nil {
+		return
+	}
+
+	settings := config.Current()
+	cutoff := time.Time{}
+	if settings.Backup.MaxAge > 0 {
+		cutoff = time.Now().Add(-time.Duration(settings.Backup.MaxAge))
+	}
+	for i, snap := range snaps {
+		if i >= settings.Backup.Keep || snap.Created.Before(cutoff) {
+			os.Remove(filepath.Join(config.BackupDir(), snap.ID+".json"))
+		}
+	}
+}
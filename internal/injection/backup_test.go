@@ -0,0 +1,191 @@
+package injection
+
+import (
+	"antigravity-cli/internal/config"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func readRow(t *testing.T, dbPath, key string) (string, bool) {
+	t.Helper()
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+	defer db.Close()
+
+	var value string
+	err = db.QueryRow("SELECT value FROM ItemTable WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false
+	}
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", key, err)
+	}
+	return value, true
+}
+
+func TestSnapshot_RestoreUndoesInjection(t *testing.T) {
+	dbPath := createTempDB(t)
+	db, _ := sql.Open("sqlite", dbPath)
+	db.Exec("INSERT INTO ItemTable (key, value) VALUES (?, ?)", "antigravityAuthStatus", `{"email":"me@example.com"}`)
+	db.Exec("INSERT INTO ItemTable (key, value) VALUES (?, ?)", "google.antigravity", "cache")
+	db.Close()
+
+	snap, err := TakeSnapshot(dbPath, "test")
+	if err != nil {
+		t.Fatalf("TakeSnapshot failed: %v", err)
+	}
+
+	err = InjectIdentity(dbPath, Identity{AccessToken: "a", Email: "other@example.com", AvatarURL: "https://example.com/a.png"})
+	if err != nil {
+		t.Fatalf("InjectIdentity failed: %v", err)
+	}
+
+	loaded, err := LoadSnapshot(snap.ID)
+	if err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if err := loaded.Restore(dbPath); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	if v, _ := readRow(t, dbPath, "antigravityAuthStatus"); v != `{"email":"me@example.com"}` {
+		t.Errorf("auth status not restored: %q", v)
+	}
+	if v, _ := readRow(t, dbPath, "google.antigravity"); v != "cache" {
+		t.Errorf("google.antigravity not restored: %q", v)
+	}
+	// Rows injection created must be gone again
+	for _, key := range []string{"antigravity.profileUrl", "jetskiStateSync.agentManagerInitState", "antigravityOnboarding"} {
+		if _, ok := readRow(t, dbPath, key); ok {
+			t.Errorf("%s should have been deleted by restore", key)
+		}
+	}
+}
+
+func TestWithSnapshot_RollsBackOnFailure(t *testing.T) {
+	dbPath := createTempDB(t)
+	db, _ := sql.Open("sqlite", dbPath)
+	db.Exec("INSERT INTO ItemTable (key, value) VALUES (?, ?)", "antigravityAuthStatus", "original")
+	db.Close()
+
+	boom := errors.New("boom")
+	err := WithSnapshot(dbPath, "test", func() error {
+		db, _ := sql.Open("sqlite", dbPath)
+		defer db.Close()
+		db.Exec("UPDATE ItemTable SET value = ? WHERE key = ?", "half-written", "antigravityAuthStatus")
+		db.Exec("INSERT INTO ItemTable (key, value) VALUES (?, ?)", "antigravityOnboarding", "true")
+		return boom
+	})
+	if !errors.Is(err, boom) || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("expected rolled back boom error, got %v", err)
+	}
+
+	if v, _ := readRow(t, dbPath, "antigravityAuthStatus"); v != "original" {
+		t.Errorf("expected original auth status, got %q", v)
+	}
+	if _, ok := readRow(t, dbPath, "antigravityOnboarding"); ok {
+		t.Error("antigravityOnboarding should have been removed by rollback")
+	}
+}
+
+func TestWithSnapshot_KeepsConcurrentWritesOnTxFailure(t *testing.T) {
+	dbPath := createTempDB(t)
+	db, _ := sql.Open("sqlite", dbPath)
+	db.Exec("INSERT INTO ItemTable (key, value) VALUES (?, ?)", "antigravityAuthStatus", "original")
+	db.Close()
+
+	boom := errors.New("boom")
+	err := WithSnapshot(dbPath, "test", func() error {
+		// The IDE writes between the snapshot and our transaction
+		db, _ := sql.Open("sqlite", dbPath)
+		db.Exec("UPDATE ItemTable SET value = ? WHERE key = ?", "written by IDE", "antigravityAuthStatus")
+		db.Close()
+
+		return withTx(dbPath, func(tx *sql.Tx) error {
+			tx.Exec("UPDATE ItemTable SET value = ? WHERE key = ?", "ours", "antigravityAuthStatus")
+			return boom
+		})
+	})
+	if err != boom {
+		t.Fatalf("expected the transaction error unchanged, got %v", err)
+	}
+	if v, _ := readRow(t, dbPath, "antigravityAuthStatus"); v != "written by IDE" {
+		t.Errorf("the IDE's write was reverted: %q", v)
+	}
+}
+
+func TestTakeSnapshot_Prunes(t *testing.T) {
+	dbPath := createTempDB(t)
+	if err := config.SetSetting("backup.keep", "3"); err != nil {
+		t.Fatalf("SetSetting failed: %v", err)
+	}
+
+	var last *Snapshot
+	for i := 0; i < 5; i++ {
+		snap, err := TakeSnapshot(dbPath, "test")
+		if err != nil {
+			t.Fatalf("TakeSnapshot failed: %v", err)
+		}
+		last = snap
+	}
+
+	snaps, err := ListSnapshots()
+	if err != nil {
+		t.Fatalf("ListSnapshots failed: %v", err)
+	}
+	if len(snaps) != 3 {
+		t.Fatalf("expected 3 snapshots after pruning, got %d", len(snaps))
+	}
+	if snaps[0].ID != last.ID {
+		t.Errorf("newest snapshot should be listed first: got %s, want %s", snaps[0].ID, last.ID)
+	}
+}
+
+func TestLoadSnapshot_RejectsPaths(t *testing.T) {
+	createTempDB(t)
+	if _, err := LoadSnapshot("../profiles"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("expected ErrSnapshotNotFound, got %v", err)
+	}
+}
+
+func TestDiffRows(t *testing.T) {
+	dbPath := createTempDB(t)
+	db, _ := sql.Open("sqlite", dbPath)
+	db.Exec("INSERT INTO ItemTable (key, value) VALUES (?, ?)", "google.antigravity", "cache")
+	db.Close()
+
+	before, err := ReadCredentialRows(dbPath)
+	if err != nil {
+		t.Fatalf("ReadCredentialRows failed: %v", err)
+	}
+	if err := InjectIdentity(dbPath, Identity{AccessToken: "a"}); err != nil {
+		t.Fatalf("InjectIdentity failed: %v", err)
+	}
+	after, _ := ReadCredentialRows(dbPath)
+
+	got := map[string]string{}
+	for _, c := range DiffRows(before, after) {
+		got[c.Key] = c.Change
+	}
+	want := map[string]string{
+		"antigravityAuthStatus":                 "added",
+		"antigravityOnboarding":                 "added",
+		"jetskiStateSync.agentManagerInitState": "added",
+		"google.antigravity":                    "deleted",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for key, change := range want {
+		if got[key] != change {
+			t.Errorf("%s: expected %s, got %q", key, change, got[key])
+		}
+	}
+	if len(DiffRows(after, after)) != 0 {
+		t.Error("identical rows must not differ")
+	}
+}
@@ -0,0 +1,93 @@
+package injection
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// busyTimeout is how long SQLite itself waits for the IDE to release the
+// database before a statement fails with SQLITE_BUSY
+var busyTimeout = 2 * time.Second
+
+var (
+	// ErrDBMissing means state.vscdb does not exist or has no ItemTable,
+	// usually because the IDE was never started or the path is wrong
+	ErrDBMissing = errors.New("IDE database not found")
+	// ErrDBLocked means the IDE kept the database locked through every retry
+	ErrDBLocked = errors.New("IDE database is locked, close Antigravity and try again")
+)
+
+// openDB opens an existing IDE database with a busy timeout and checks that
+// it has an ItemTable. Unlike sql.Open it never creates an empty file.
+func openDB(dbPath string) (*sql.DB, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrDBMissing, dbPath)
+		}
+		return nil, fmt.Errorf("failed to access database: %w", err)
+	}
+
+	// The driver strips the query from plain paths and applies it as pragmas
+	dsn := fmt.Sprintf("%s?_pragma=busy_timeout(%d)", dbPath, busyTimeout.Milliseconds())
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	var name string
+	err = db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'ItemTable'").Scan(&name)
+	if err != nil {
+		db.Close()
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s has no ItemTable", ErrDBMissing, dbPath)
+		}
+		return nil, fmt.Errorf("failed to read database schema: %w", err)
+	}
+	return db, nil
+}
+
+// txError is a withTx failure. The transaction was rolled back, so the
+// database holds whatever it held before (or whatever others wrote since).
+type txError struct {
+	err error
+}
+
+func (e *txError) Error() string { return e.err.Error() }
+func (e *txError) Unwrap() error { return e.err }
+
+// withTx runs fn in a single transaction on the database at dbPath. The whole
+// transaction is retried while the database is locked, so fn must only touch
+// the database through tx. Its errors are *txError.
+func withTx(dbPath string, fn func(tx *sql.Tx) error) error {
+	err := retryLocked(func() error {
+		db, err := openDB(dbPath)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit: %w", err)
+		}
+		return nil
+	})
+	if isLocked(err) {
+		return &txError{fmt.Errorf("%w: %v", ErrDBLocked, err)}
+	}
+	if err != nil {
+		return &txError{err}
+	}
+	return nil
+}
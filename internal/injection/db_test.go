@@ -0,0 +1,77 @@
+package injection
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInjectIdentity_MissingDB(t *testing.T) {
+	dbPath := filepath.Join(filepath.Dir(createTempDB(t)), "missing.vscdb")
+
+	err := InjectIdentity(dbPath, Identity{AccessToken: "a"})
+	if !errors.Is(err, ErrDBMissing) {
+		t.Fatalf("expected ErrDBMissing, got %v", err)
+	}
+	if _, err := os.Stat(dbPath); !os.IsNotExist(err) {
+		t.Error("a missing database must not be created")
+	}
+}
+
+func TestInjectIdentity_NoItemTable(t *testing.T) {
+	dbPath := filepath.Join(filepath.Dir(createTempDB(t)), "empty.vscdb")
+	db, _ := sql.Open("sqlite", dbPath)
+	db.Exec("CREATE TABLE Other (x TEXT)")
+	db.Close()
+
+	if err := InjectIdentity(dbPath, Identity{AccessToken: "a"}); !errors.Is(err, ErrDBMissing) {
+		t.Fatalf("expected ErrDBMissing, got %v", err)
+	}
+}
+
+func TestClearIdentity_Locked(t *testing.T) {
+	dbPath := createTempDB(t)
+	oldTimeout, oldBackoff := busyTimeout, lockRetryBackoff
+	busyTimeout, lockRetryBackoff = 10*time.Millisecond, time.Millisecond
+	t.Cleanup(func() { busyTimeout, lockRetryBackoff = oldTimeout, oldBackoff })
+
+	// Another connection holding a write lock plays the running IDE
+	holder, _ := sql.Open("sqlite", dbPath)
+	defer holder.Close()
+	holder.SetMaxOpenConns(1)
+	tx, err := holder.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("INSERT INTO ItemTable (key, value) VALUES ('lock', 'held')"); err != nil {
+		t.Fatalf("Failed to take write lock: %v", err)
+	}
+
+	if err := ClearIdentity(dbPath); !errors.Is(err, ErrDBLocked) {
+		t.Fatalf("expected ErrDBLocked, got %v", err)
+	}
+}
+
+func TestClearIdentity_SignsOut(t *testing.T) {
+	dbPath := createTempDB(t)
+	if err := InjectIdentity(dbPath, Identity{AccessToken: "a", AvatarURL: "https://example.com/a.png"}); err != nil {
+		t.Fatalf("InjectIdentity failed: %v", err)
+	}
+
+	if err := ClearIdentity(dbPath); err != nil {
+		t.Fatalf("ClearIdentity failed: %v", err)
+	}
+	if v, _ := readRow(t, dbPath, "antigravityAuthStatus"); v != "null" {
+		t.Errorf("expected auth status \"null\", got %q", v)
+	}
+	if v, _ := readRow(t, dbPath, "jetskiStateSync.agentManagerInitState"); v != "mgEA" {
+		t.Errorf("expected minimal protobuf, got %q", v)
+	}
+	if _, ok := readRow(t, dbPath, "antigravity.profileUrl"); ok {
+		t.Error("antigravity.profileUrl should be deleted")
+	}
+}
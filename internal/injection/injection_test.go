@@ -1,9 +1,11 @@
 package injection
 
 import (
+	"antigravity-cli/internal/config"
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"path/filepath"
 	"testing"
 	"time"
@@ -13,6 +15,10 @@ import (
 
 func createTempDB(t *testing.T) string {
 	dir := t.TempDir()
+	// Snapshots go to the data directory, keep them out of the real home
+	if err := config.InitSettings(dir); err != nil {
+		t.Fatalf("Failed to init settings: %v", err)
+	}
 	dbPath := filepath.Join(dir, "test.db")
 	db, err := sql.Open("sqlite", dbPath)
 	if err != nil {
@@ -30,7 +36,13 @@ func createTempDB(t *testing.T) string {
 func TestInjectIdentity_MissingRecord(t *testing.T) {
 	dbPath := createTempDB(t)
 	
-	err := InjectIdentity(dbPath, "test_access", "test_refresh", "test@example.com", "Test User")
+	err := InjectIdentity(dbPath, Identity{
+		AccessToken:  "test_access",
+		RefreshToken: "test_refresh",
+		Email:        "test@example.com",
+		Name:         "Test User",
+		AvatarURL:    "https://example.com/avatar.png",
+	})
 	if err != nil {
 		t.Fatalf("InjectIdentity failed: %v", err)
 	}
@@ -57,6 +69,25 @@ func TestInjectIdentity_MissingRecord(t *testing.T) {
 	if err != nil || val != "true" {
 		t.Errorf("antigravityOnboarding missing or invalid")
 	}
+
+	err = db.QueryRow("SELECT value FROM ItemTable WHERE key = ?", "antigravity.profileUrl").Scan(&val)
+	if err != nil || val != "https://example.com/avatar.png" {
+		t.Errorf("antigravity.profileUrl missing or invalid: %q", val)
+	}
+}
+
+func TestInjectIdentity_RemovesPreviousAvatar(t *testing.T) {
+	dbPath := createTempDB(t)
+	if err := InjectIdentity(dbPath, Identity{AccessToken: "a", Email: "a@example.com", AvatarURL: "https://example.com/a.png"}); err != nil {
+		t.Fatalf("InjectIdentity failed: %v", err)
+	}
+
+	if err := InjectIdentity(dbPath, Identity{AccessToken: "b", Email: "b@example.com"}); err != nil {
+		t.Fatalf("InjectIdentity failed: %v", err)
+	}
+	if v, ok := readRow(t, dbPath, "antigravity.profileUrl"); ok {
+		t.Errorf("previous account's avatar left behind: %q", v)
+	}
 }
 
 func TestInjectIdentity_ExistingRecord(t *testing.T) {
@@ -81,7 +112,12 @@ func TestInjectIdentity_ExistingRecord(t *testing.T) {
 	}
 
 	// Run Injection
-	err = InjectIdentity(dbPath, "new_access", "new_refresh", "new@example.com", "New User")
+	err = InjectIdentity(dbPath, Identity{
+		AccessToken:  "new_access",
+		RefreshToken: "new_refresh",
+		Email:        "new@example.com",
+		Name:         "New User",
+	})
 	if err != nil {
 		t.Fatalf("InjectIdentity failed: %v", err)
 	}
@@ -112,3 +148,118 @@ func TestInjectIdentity_ExistingRecord(t *testing.T) {
 		t.Errorf("Expected refresh token 'new_refresh', got '%s'", refresh)
 	}
 }
+
+func TestUpdateTokens_PreservesOtherFields(t *testing.T) {
+	dbPath := createTempDB(t)
+	db, _ := sql.Open("sqlite", dbPath)
+	defer db.Close()
+
+	// Field 5 (string) stands in for IDE state we must not lose
+	other := CreateStringField(5, "keep_me")
+	initial := append(append([]byte{}, other...), CreateOAuthTokenInfo("old_access", "old_refresh", 100)...)
+	_, err := db.Exec("INSERT INTO ItemTable (key, value) VALUES (?, ?)", "jetskiStateSync.agentManagerInitState", base64.StdEncoding.EncodeToString(initial))
+	if err != nil {
+		t.Fatalf("Failed to insert initial state: %v", err)
+	}
+	_, err = db.Exec("INSERT INTO ItemTable (key, value) VALUES (?, ?)", "antigravityAuthStatus", `{"name":"Old User","email":"old@example.com","apiKey":"old_access"}`)
+	if err != nil {
+		t.Fatalf("Failed to insert auth status: %v", err)
+	}
+
+	expiry := time.Now().Add(time.Hour).Unix()
+	if err := UpdateTokens(dbPath, "new_access", "old_refresh", expiry); err != nil {
+		t.Fatalf("UpdateTokens failed: %v", err)
+	}
+
+	var val string
+	if err := db.QueryRow("SELECT value FROM ItemTable WHERE key = ?", "jetskiStateSync.agentManagerInitState").Scan(&val); err != nil {
+		t.Fatalf("Main record missing")
+	}
+	decoded, _ := base64.StdEncoding.DecodeString(val)
+
+	if got := string(GetField(decoded, 5)); got != "keep_me" {
+		t.Errorf("Expected field 5 to be preserved, got '%s'", got)
+	}
+	access, refresh, err := ExtractOAuthTokenInfo(decoded)
+	if err != nil {
+		t.Fatalf("Failed to extract token info: %v", err)
+	}
+	if access != "new_access" || refresh != "old_refresh" {
+		t.Errorf("Unexpected tokens: %s / %s", access, refresh)
+	}
+	seconds, _, _ := ReadVarint(GetField(GetField(decoded, 6), 4), 1)
+	if int64(seconds) != expiry {
+		t.Errorf("Expected expiry %d, got %d", expiry, seconds)
+	}
+
+	if err := db.QueryRow("SELECT value FROM ItemTable WHERE key = ?", "antigravityAuthStatus").Scan(&val); err != nil {
+		t.Fatalf("antigravityAuthStatus missing")
+	}
+	var status AuthStatus
+	json.Unmarshal([]byte(val), &status)
+	if status.ApiKey != "new_access" || status.Email != "old@example.com" || status.Name != "Old User" {
+		t.Errorf("Unexpected auth status: %+v", status)
+	}
+}
+
+func TestInjectIdentity_MergeAndReplace(t *testing.T) {
+	for _, tc := range []struct {
+		mode     InjectMode
+		wantKept bool
+	}{
+		{"", true},
+		{ModeMerge, true},
+		{ModeReplace, false},
+	} {
+		dbPath := createTempDB(t)
+		db, _ := sql.Open("sqlite", dbPath)
+
+		initial := append(CreateStringField(5, "keep_me"), CreateOAuthTokenInfo("old_access", "old_refresh", 100)...)
+		_, err := db.Exec("INSERT INTO ItemTable (key, value) VALUES (?, ?)", "jetskiStateSync.agentManagerInitState", base64.StdEncoding.EncodeToString(initial))
+		if err != nil {
+			t.Fatalf("Failed to insert initial state: %v", err)
+		}
+
+		if err := InjectIdentity(dbPath, Identity{AccessToken: "new_access", RefreshToken: "new_refresh", Mode: tc.mode}); err != nil {
+			t.Fatalf("mode %q: InjectIdentity failed: %v", tc.mode, err)
+		}
+
+		var val string
+		db.QueryRow("SELECT value FROM ItemTable WHERE key = ?", "jetskiStateSync.agentManagerInitState").Scan(&val)
+		db.Close()
+		decoded, _ := base64.StdEncoding.DecodeString(val)
+
+		if kept := string(GetField(decoded, 5)) == "keep_me"; kept != tc.wantKept {
+			t.Errorf("mode %q: field 5 kept = %v, want %v", tc.mode, kept, tc.wantKept)
+		}
+		access, refresh, err := ExtractOAuthTokenInfo(decoded)
+		if err != nil || access != "new_access" || refresh != "new_refresh" {
+			t.Errorf("mode %q: unexpected tokens %q/%q (%v)", tc.mode, access, refresh, err)
+		}
+	}
+}
+
+func TestInjectIdentity_UndecodableStateNeedsReplace(t *testing.T) {
+	dbPath := createTempDB(t)
+	db, _ := sql.Open("sqlite", dbPath)
+	defer db.Close()
+	// A length-delimited field 5 claiming more bytes than there are
+	garbage := base64.StdEncoding.EncodeToString([]byte{0x2a, 0x10, 'x'})
+	if _, err := db.Exec("INSERT INTO ItemTable (key, value) VALUES (?, ?)", "jetskiStateSync.agentManagerInitState", garbage); err != nil {
+		t.Fatalf("Failed to insert initial state: %v", err)
+	}
+
+	err := InjectIdentity(dbPath, Identity{AccessToken: "new_access"})
+	if !errors.Is(err, ErrCannotMerge) {
+		t.Fatalf("expected ErrCannotMerge, got %v", err)
+	}
+	var val string
+	db.QueryRow("SELECT value FROM ItemTable WHERE key = ?", "jetskiStateSync.agentManagerInitState").Scan(&val)
+	if val != garbage {
+		t.Errorf("state overwritten in merge mode: %q", val)
+	}
+
+	if err := InjectIdentity(dbPath, Identity{AccessToken: "new_access", Mode: ModeReplace}); err != nil {
+		t.Fatalf("replace mode failed: %v", err)
+	}
+}
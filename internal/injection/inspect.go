@@ -0,0 +1,205 @@
+package injection
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxInspectDepth stops nested-message guessing on pathological input
+const maxInspectDepth = 32
+
+// ProtoField is one field of a protobuf message decoded without a schema.
+// Length-delimited values are guessed: a string if they are printable UTF-8,
+// else a nested message if the bytes parse as one, else raw bytes.
+type ProtoField struct {
+	Number   int    `json:"field"`
+	WireType int    `json:"wire_type"`
+	Kind     string `json:"kind"` // varint, fixed64, fixed32, string, bytes, message, group, timestamp
+
+	Varint  *uint64      `json:"varint,omitempty"`
+	Fixed   *uint64      `json:"fixed,omitempty"`
+	String  *string      `json:"string,omitempty"`
+	Bytes   []byte       `json:"bytes,omitempty"`
+	Message []ProtoField `json:"message,omitempty"` // also the fields of a group
+	// Time is set for messages shaped like google.protobuf.Timestamp
+	// (field 1 seconds, optional field 2 nanos) holding a plausible date
+	Time *time.Time `json:"time,omitempty"`
+}
+
+// DecodeMessage parses data as a protobuf message without a schema
+func DecodeMessage(data []byte) ([]ProtoField, error) {
+	fields, _, err := decodeFields(data, 0, 0, -1)
+	return fields, err
+}
+
+// decodeFields decodes fields from offset to the end of data, or up to the
+// end group tag of group when group is not -1
+func decodeFields(data []byte, offset int, depth int, group int) ([]ProtoField, int, error) {
+	var fields []ProtoField
+	for offset < len(data) {
+		num, wireType, next, err := ReadTag(data, offset)
+		if err != nil {
+			return fields, offset, err
+		}
+		f := ProtoField{Number: num, WireType: wireType}
+
+		switch wireType {
+		case WireVarint:
+			v, end, err := ReadVarint(data, next)
+			if err != nil {
+				return fields, offset, err
+			}
+			f.Kind, f.Varint = "varint", &v
+			next = end
+		case WireFixed64, WireFixed32:
+			size := 8
+			if wireType == WireFixed32 {
+				size = 4
+			}
+			end, err := skipBytes(data, next, size)
+			if err != nil {
+				return fields, offset, err
+			}
+			var v uint64
+			for i := size - 1; i >= 0; i-- {
+				v = v<<8 | uint64(data[next+i])
+			}
+			f.Kind, f.Fixed = fmt.Sprintf("fixed%d", size*8), &v
+			next = end
+		case WireBytes:
+			length, start, err := ReadVarint(data, next)
+			if err != nil {
+				return fields, offset, err
+			}
+			if length > uint64(len(data)-start) {
+				return fields, offset, &ParseError{Offset: next, Err: ErrTruncated}
+			}
+			guessLengthDelimited(&f, data[start:start+int(length)], depth)
+			next = start + int(length)
+		case WireStartGroup:
+			if depth >= maxInspectDepth {
+				return fields, offset, &ParseError{Offset: offset, Err: ErrGroupDepth}
+			}
+			msg, end, err := decodeFields(data, next, depth+1, num)
+			if err != nil {
+				return fields, offset, err
+			}
+			f.Kind, f.Message = "group", msg
+			next = end
+		case WireEndGroup:
+			if num != group {
+				return fields, offset, &ParseError{Offset: offset, Err: ErrWireType}
+			}
+			return fields, next, nil
+		default:
+			return fields, offset, &ParseError{Offset: offset, Err: ErrWireType}
+		}
+		fields = append(fields, f)
+		offset = next
+	}
+	if group != -1 {
+		return fields, offset, &ParseError{Offset: offset, Err: ErrTruncated}
+	}
+	return fields, offset, nil
+}
+
+func guessLengthDelimited(f *ProtoField, value []byte, depth int) {
+	if isPrintable(value) {
+		s := string(value)
+		f.Kind, f.String = "string", &s
+		return
+	}
+	if len(value) > 0 && depth < maxInspectDepth {
+		if msg, _, err := decodeFields(value, 0, depth+1, -1); err == nil {
+			f.Kind, f.Message = "message", msg
+			if t, ok := asTimestamp(msg); ok {
+				f.Kind, f.Time = "timestamp", &t
+			}
+			return
+		}
+	}
+	f.Kind, f.Bytes = "bytes", value
+}
+
+// isPrintable reports whether value looks like text rather than binary
+func isPrintable(value []byte) bool {
+	if len(value) == 0 || !utf8.Valid(value) {
+		return false
+	}
+	for _, r := range string(value) {
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// asTimestamp recognises google.protobuf.Timestamp between 2000 and 2100
+func asTimestamp(msg []ProtoField) (time.Time, bool) {
+	var seconds, nanos uint64
+	for _, f := range msg {
+		switch {
+		case f.Number == 1 && f.Varint != nil:
+			seconds = *f.Varint
+		case f.Number == 2 && f.Varint != nil && *f.Varint < 1e9:
+			nanos = *f.Varint
+		default:
+			return time.Time{}, false
+		}
+	}
+	if seconds < 946684800 || seconds > 4102444800 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), int64(nanos)).UTC(), true
+}
+
+// FormatFields renders decoded fields as an indented tree, one field per line
+func FormatFields(fields []ProtoField) string {
+	var b strings.Builder
+	formatFields(&b, fields, "")
+	return b.String()
+}
+
+func formatFields(b *strings.Builder, fields []ProtoField, indent string) {
+	for _, f := range fields {
+		fmt.Fprintf(b, "%s%d: ", indent, f.Number)
+		switch f.Kind {
+		case "varint":
+			fmt.Fprintf(b, "varint %d\n", *f.Varint)
+		case "fixed64", "fixed32":
+			fmt.Fprintf(b, "%s %d (0x%x)\n", f.Kind, *f.Fixed, *f.Fixed)
+		case "string":
+			fmt.Fprintf(b, "string %q\n", *f.String)
+		case "bytes":
+			fmt.Fprintf(b, "bytes (%d) %x\n", len(f.Bytes), f.Bytes)
+		case "timestamp":
+			fmt.Fprintf(b, "timestamp %s (%d)\n", f.Time.Format(time.RFC3339Nano), f.Time.Unix())
+		case "message", "group":
+			fmt.Fprintf(b, "%s {\n", f.Kind)
+			formatFields(b, f.Message, indent+"  ")
+			fmt.Fprintf(b, "%s}\n", indent)
+		}
+	}
+}
+
+// ReadItem returns the ItemTable value stored under key; ok is false when
+// there is no such row
+func ReadItem(dbPath, key string) (value string, ok bool, err error) {
+	db, err := openDB(dbPath)
+	if err != nil {
+		return "", false, err
+	}
+	defer db.Close()
+
+	err = db.QueryRow("SELECT value FROM ItemTable WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return value, true, nil
+}
@@ -0,0 +1,55 @@
+package injection
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeMessage_OAuthTokenInfo(t *testing.T) {
+	expiry := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC).Unix()
+	data := append(CreateStringField(5, "keep_me"), CreateOAuthTokenInfo("access", "refresh", expiry)...)
+	data = append(data, EncodeVarint(7<<3|0)...)
+	data = append(data, EncodeVarint(42)...)
+
+	fields, err := DecodeMessage(data)
+	if err != nil {
+		t.Fatalf("DecodeMessage failed: %v", err)
+	}
+	if len(fields) != 3 {
+		t.Fatalf("expected 3 top-level fields, got %d", len(fields))
+	}
+	if fields[0].Kind != "string" || *fields[0].String != "keep_me" {
+		t.Errorf("field 5: got %+v", fields[0])
+	}
+	if fields[2].Kind != "varint" || *fields[2].Varint != 42 {
+		t.Errorf("field 7: got %+v", fields[2])
+	}
+
+	info := fields[1]
+	if info.Number != 6 || info.Kind != "message" || len(info.Message) != 4 {
+		t.Fatalf("field 6: expected message with 4 fields, got %+v", info)
+	}
+	ts := info.Message[3]
+	if ts.Kind != "timestamp" || ts.Time.Unix() != expiry {
+		t.Errorf("field 6.4: expected timestamp %d, got %+v", expiry, ts)
+	}
+
+	out := FormatFields(fields)
+	for _, want := range []string{`5: string "keep_me"`, "6: message {", `  1: string "access"`, "  4: timestamp 2026-01-02T03:04:05Z", "7: varint 42"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("formatted tree lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestDecodeMessage_Truncated(t *testing.T) {
+	data := CreateOAuthTokenInfo("access", "refresh", 100)
+	fields, err := DecodeMessage(data[:len(data)-3])
+	if err == nil {
+		t.Fatal("expected an error for truncated data")
+	}
+	if len(fields) != 0 {
+		t.Errorf("expected no complete fields, got %d", len(fields))
+	}
+}
@@ -2,6 +2,8 @@ package injection
 
 import (
 	"errors"
+	"fmt"
+	"time"
 )
 
 // ProtobufUtils handling for specific binary manipulation
@@ -17,81 +19,190 @@ func EncodeVarint(value uint64) []byte {
 	return buf
 }
 
+// Wire types of the protobuf encoding
+const (
+	WireVarint     = 0
+	WireFixed64    = 1
+	WireBytes      = 2
+	WireStartGroup = 3
+	WireEndGroup   = 4
+	WireFixed32    = 5
+)
+
+// maxGroupDepth bounds group nesting so hostile input cannot exhaust the stack
+const maxGroupDepth = 64
+
+var (
+	// ErrTruncated means a field runs past the end of the data
+	ErrTruncated = errors.New("truncated protobuf data")
+	// ErrVarintOverflow means a varint is longer than 64 bits
+	ErrVarintOverflow = errors.New("varint overflow")
+	// ErrWireType means a tag carries wire type 6 or 7, or an unmatched end group
+	ErrWireType = errors.New("invalid wire type")
+	// ErrFieldNumber means a tag carries field number 0 or one above 2^29-1
+	ErrFieldNumber = errors.New("invalid field number")
+	// ErrGroupDepth means groups are nested deeper than maxGroupDepth
+	ErrGroupDepth = errors.New("groups nested too deeply")
+)
+
+// ParseError is returned for malformed protobuf data. It wraps one of the
+// Err* values above and records where parsing stopped.
+type ParseError struct {
+	Offset int
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v at offset %d", e.Err, e.Offset)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
 func ReadVarint(data []byte, offset int) (uint64, int, error) {
+	if offset < 0 || offset > len(data) {
+		return 0, 0, &ParseError{Offset: offset, Err: ErrTruncated}
+	}
+
 	var result uint64
-	var shift uint64
 	pos := offset
-
-	for pos < len(data) {
+	for shift := uint(0); shift < 64; shift += 7 {
+		if pos >= len(data) {
+			return 0, 0, &ParseError{Offset: offset, Err: ErrTruncated}
+		}
 		b := data[pos]
-		result |= uint64(b&0x7F) << shift
 		pos++
+		// The tenth byte may only carry the top bit of a 64-bit value
+		if shift == 63 && b > 1 {
+			return 0, 0, &ParseError{Offset: offset, Err: ErrVarintOverflow}
+		}
+		result |= uint64(b&0x7F) << shift
 		if (b & 0x80) == 0 {
 			return result, pos, nil
 		}
-		shift += 7
-		if shift >= 64 {
-			return 0, 0, errors.New("varint overflow")
-		}
 	}
-	return 0, 0, errors.New("incomplete varint data")
+	return 0, 0, &ParseError{Offset: offset, Err: ErrVarintOverflow}
+}
+
+// ReadTag reads a field tag at offset and returns its field number and wire type
+func ReadTag(data []byte, offset int) (fieldNum int, wireType int, next int, err error) {
+	tag, next, err := ReadVarint(data, offset)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if tag>>3 == 0 || tag>>3 > 1<<29-1 {
+		return 0, 0, 0, &ParseError{Offset: offset, Err: ErrFieldNumber}
+	}
+	return int(tag >> 3), int(tag & 7), next, nil
 }
 
-// SkipField returns the new offset after skipping the field at the given offset
+// SkipField returns the new offset after skipping the field at the given offset.
+// The returned offset never exceeds len(data). For a group (wire type 3) the
+// nested fields up to the matching end group are skipped.
 func SkipField(data []byte, offset int, wireType int) (int, error) {
+	return skipField(data, offset, -1, wireType, 0)
+}
+
+// skipField skips one field value; fieldNum is the group's field number the
+// end group tag must match, -1 when unknown
+func skipField(data []byte, offset int, fieldNum int, wireType int, depth int) (int, error) {
+	if offset < 0 || offset > len(data) {
+		return 0, &ParseError{Offset: offset, Err: ErrTruncated}
+	}
+
 	switch wireType {
-	case 0: // Varint
+	case WireVarint:
 		_, nextOffset, err := ReadVarint(data, offset)
 		return nextOffset, err
-	case 1: // 64-bit
-		return offset + 8, nil
-	case 2: // Length-delimited
+	case WireFixed64:
+		return skipBytes(data, offset, 8)
+	case WireBytes:
 		length, nextOffset, err := ReadVarint(data, offset)
 		if err != nil {
 			return 0, err
 		}
+		if length > uint64(len(data)-nextOffset) {
+			return 0, &ParseError{Offset: offset, Err: ErrTruncated}
+		}
 		return nextOffset + int(length), nil
-	case 5: // 32-bit
-		return offset + 4, nil
+	case WireStartGroup:
+		if depth >= maxGroupDepth {
+			return 0, &ParseError{Offset: offset, Err: ErrGroupDepth}
+		}
+		for {
+			num, wt, next, err := ReadTag(data, offset)
+			if err != nil {
+				return 0, err
+			}
+			if wt == WireEndGroup {
+				if fieldNum >= 0 && num != fieldNum {
+					return 0, &ParseError{Offset: offset, Err: ErrWireType}
+				}
+				return next, nil
+			}
+			offset, err = skipField(data, next, num, wt, depth+1)
+			if err != nil {
+				return 0, err
+			}
+		}
+	case WireFixed32:
+		return skipBytes(data, offset, 4)
 	default:
-		return 0, errors.New("unknown wire type")
+		// A lone end group has no start to close
+		return 0, &ParseError{Offset: offset, Err: ErrWireType}
 	}
 }
 
+func skipBytes(data []byte, offset int, n int) (int, error) {
+	if len(data)-offset < n {
+		return 0, &ParseError{Offset: offset, Err: ErrTruncated}
+	}
+	return offset + n, nil
+}
+
+// RemoveField returns a copy of data without any occurrence of fieldNum.
+// Malformed data is reported as a *ParseError, never a panic.
 func RemoveField(data []byte, fieldNum int) ([]byte, error) {
-	var result []byte
+	result := make([]byte, 0, len(data))
 	offset := 0
 
 	for offset < len(data) {
 		startOffset := offset
-		tag, nextOffset, err := ReadVarint(data, offset)
+		currentField, wireType, nextOffset, err := ReadTag(data, offset)
 		if err != nil {
 			return nil, err
 		}
-		
-		wireType := int(tag & 7)
-		currentField := int(tag >> 3)
 
-		if currentField == fieldNum {
-			// Skip
-			nextOffset, err := SkipField(data, nextOffset, wireType)
-			if err != nil {
-				return nil, err
-			}
-			offset = nextOffset
-		} else {
-			// Copy
-			endOffset, err := SkipField(data, nextOffset, wireType)
-			if err != nil {
-				return nil, err
-			}
+		endOffset, err := skipField(data, nextOffset, currentField, wireType, 0)
+		if err != nil {
+			return nil, err
+		}
+		if currentField != fieldNum {
 			result = append(result, data[startOffset:endOffset]...)
-			offset = endOffset
 		}
+		offset = endOffset
 	}
 	return result, nil
 }
 
+// AppendTag appends a field tag
+func AppendTag(b []byte, fieldNum int, wireType int) []byte {
+	return append(b, EncodeVarint(uint64(fieldNum)<<3|uint64(wireType))...)
+}
+
+// AppendVarintField appends fieldNum as a varint field
+func AppendVarintField(b []byte, fieldNum int, value uint64) []byte {
+	b = AppendTag(b, fieldNum, WireVarint)
+	return append(b, EncodeVarint(value)...)
+}
+
+// AppendBytesField appends fieldNum as a length-delimited field, used for
+// strings and nested messages alike
+func AppendBytesField(b []byte, fieldNum int, value []byte) []byte {
+	b = AppendTag(b, fieldNum, WireBytes)
+	b = append(b, EncodeVarint(uint64(len(value)))...)
+	return append(b, value...)
+}
+
 func CreateStringField(fieldNum int, value string) []byte {
 	tag := (uint64(fieldNum) << 3) | 2
 	bytes := []byte(value)
@@ -128,79 +239,55 @@ func CreateTimestampField(fieldNum int, seconds int64) []byte {
 	return result
 }
 
+// CreateOAuthTokenInfo builds field 6 of agentManagerInitState with a Bearer token
 func CreateOAuthTokenInfo(accessToken string, refreshToken string, expiry int64) []byte {
-	f1 := CreateStringField(1, accessToken)
-	f2 := CreateStringField(2, "Bearer")
-	f3 := CreateStringField(3, refreshToken)
-	f4 := CreateTimestampField(4, expiry)
-	
-	combined := make([]byte, 0, len(f1)+len(f2)+len(f3)+len(f4))
-	combined = append(combined, f1...)
-	combined = append(combined, f2...)
-	combined = append(combined, f3...)
-	combined = append(combined, f4...)
-	
-	// Wrap as Field 6
-	tag6 := (uint64(6) << 3) | 2
-	tag6Bytes := EncodeVarint(tag6)
-	lenBytes := EncodeVarint(uint64(len(combined)))
-	
-	result := make([]byte, 0, len(tag6Bytes)+len(lenBytes)+len(combined))
-	result = append(result, tag6Bytes...)
-	result = append(result, lenBytes...)
-	result = append(result, combined...)
-	
-	return result
+	info := OAuthTokenInfo{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		RefreshToken: refreshToken,
+		Expiry:       time.Unix(expiry, 0),
+	}
+	return AppendBytesField(nil, tokenInfoField, info.Marshal())
 }
 
+// GetField returns the value of the first length-delimited fieldNum in data,
+// or nil if there is none or the data is malformed before it
 func GetField(data []byte, fieldNum int) []byte {
 	offset := 0
 	for offset < len(data) {
-		tag, nextOffset, err := ReadVarint(data, offset)
+		currentField, wireType, nextOffset, err := ReadTag(data, offset)
 		if err != nil {
 			return nil
 		}
-		
-		wireType := int(tag & 7)
-		currentField := int(tag >> 3)
 
 		if currentField == fieldNum {
-			if wireType == 2 {
+			if wireType == WireBytes {
 				length, start, err := ReadVarint(data, nextOffset)
-				if err != nil {
+				if err != nil || length > uint64(len(data)-start) {
 					return nil
 				}
-				end := start + int(length)
-				if end > len(data) {
-					return nil
-				}
-				return data[start:end]
+				return data[start : start+int(length)]
 			}
 			return nil
 		}
-		
-		nextOffset, _ = SkipField(data, nextOffset, wireType)
-		offset = nextOffset
+
+		offset, err = skipField(data, nextOffset, currentField, wireType, 0)
+		if err != nil {
+			return nil
+		}
 	}
 	return nil
 }
 
+// ExtractOAuthTokenInfo returns the access and refresh tokens of an
+// agentManagerInitState value, see ReadOAuthTokenInfo for the rest
 func ExtractOAuthTokenInfo(data []byte) (string, string, error) {
-	// Field 6 is OAuthTokenInfo
-	field6 := GetField(data, 6)
-	if field6 == nil {
-		return "", "", errors.New("field 6 (OAuthTokenInfo) not found")
+	info, err := ReadOAuthTokenInfo(data)
+	if err != nil {
+		return "", "", err
 	}
-
-	// Inside Field 6:
-	// Field 1: Access Token
-	// Field 3: Refresh Token
-	
-	accessTokenBytes := GetField(field6, 1)
-	refreshTokenBytes := GetField(field6, 3)
-
-	if accessTokenBytes != nil && refreshTokenBytes != nil {
-		return string(accessTokenBytes), string(refreshTokenBytes), nil
+	if info.AccessToken == "" {
+		return "", "", errors.New("incomplete token info")
 	}
-	return "", "", errors.New("incomplete token info")
+	return info.AccessToken, info.RefreshToken, nil
 }
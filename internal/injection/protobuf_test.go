@@ -0,0 +1,135 @@
+package injection
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSkipField_Bounds(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		data     []byte
+		wireType int
+	}{
+		{"fixed64", []byte{1, 2, 3}, WireFixed64},
+		{"fixed32", []byte{1, 2}, WireFixed32},
+		{"bytes", []byte{10, 'a'}, WireBytes},
+		{"huge length", append(EncodeVarint(1<<63), 'a'), WireBytes},
+		{"open group", []byte{8, 1}, WireStartGroup},
+	} {
+		if _, err := SkipField(tc.data, 0, tc.wireType); !errors.Is(err, ErrTruncated) {
+			t.Errorf("%s: expected ErrTruncated, got %v", tc.name, err)
+		}
+	}
+
+	if _, err := SkipField([]byte{0}, 0, 6); !errors.Is(err, ErrWireType) {
+		t.Errorf("wire type 6: expected ErrWireType, got %v", err)
+	}
+}
+
+func TestReadVarint_Overflow(t *testing.T) {
+	data := bytes.Repeat([]byte{0xff}, 10)
+	data = append(data, 0x01)
+	if _, _, err := ReadVarint(data, 0); !errors.Is(err, ErrVarintOverflow) {
+		t.Errorf("expected ErrVarintOverflow, got %v", err)
+	}
+
+	max := EncodeVarint(^uint64(0))
+	if v, _, err := ReadVarint(max, 0); err != nil || v != ^uint64(0) {
+		t.Errorf("max uint64: got %d, %v", v, err)
+	}
+}
+
+func TestRemoveField_Groups(t *testing.T) {
+	// Field 2 is a group holding a varint and a nested group
+	var data []byte
+	data = AppendVarintField(data, 1, 7)
+	data = AppendTag(data, 2, WireStartGroup)
+	data = AppendVarintField(data, 1, 8)
+	data = AppendTag(data, 3, WireStartGroup)
+	data = AppendTag(data, 3, WireEndGroup)
+	data = AppendTag(data, 2, WireEndGroup)
+	data = AppendBytesField(data, 6, []byte("token"))
+
+	out, err := RemoveField(data, 6)
+	if err != nil {
+		t.Fatalf("RemoveField failed: %v", err)
+	}
+	if !bytes.Equal(out, data[:len(data)-7]) {
+		t.Errorf("expected the group to be kept verbatim, got %x", out)
+	}
+	if got := GetField(data, 6); string(got) != "token" {
+		t.Errorf("GetField past a group: got %q", got)
+	}
+
+	// A group closed with another field number is malformed
+	bad := AppendTag(AppendTag(nil, 2, WireStartGroup), 3, WireEndGroup)
+	if _, err := RemoveField(bad, 6); !errors.Is(err, ErrWireType) {
+		t.Errorf("mismatched end group: expected ErrWireType, got %v", err)
+	}
+}
+
+func TestRemoveField_Truncated(t *testing.T) {
+	data := append(CreateStringField(5, "keep_me"), CreateOAuthTokenInfo("access", "refresh", 100)...)
+	for i := 1; i < len(data); i++ {
+		if _, err := RemoveField(data[:i], 6); err != nil {
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("truncated at %d: expected *ParseError, got %T", i, err)
+			}
+		}
+	}
+}
+
+func fuzzSeeds(f *testing.F) {
+	f.Add(CreateOAuthTokenInfo("access", "refresh", 1700000000))
+	f.Add(append(CreateStringField(5, "keep_me"), CreateOAuthTokenInfo("a", "r", 0)...))
+	f.Add([]byte{0x9a, 0x01, 0x00}) // "mgEA", the signed-out state
+	f.Add(AppendTag(AppendTag(nil, 2, WireStartGroup), 2, WireEndGroup))
+	f.Add([]byte{0x0a, 0xff, 0xff, 0xff, 0xff, 0x0f})
+	f.Add([]byte{})
+}
+
+func FuzzExtractOAuthTokenInfo(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		access, refresh, err := ExtractOAuthTokenInfo(data)
+		if err == nil && (len(access) > len(data) || len(refresh) > len(data)) {
+			t.Fatalf("tokens longer than the input")
+		}
+	})
+}
+
+func FuzzRemoveField(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		out, err := RemoveField(data, 6)
+		if err != nil {
+			return
+		}
+		if len(out) > len(data) {
+			t.Fatalf("output longer than input")
+		}
+		// What is left must still parse and no longer hold field 6
+		again, err := RemoveField(out, 6)
+		if err != nil {
+			t.Fatalf("output of RemoveField does not parse: %v", err)
+		}
+		if !bytes.Equal(again, out) {
+			t.Fatalf("field 6 survived RemoveField")
+		}
+	})
+}
+
+func FuzzGetField(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, num := range []int{1, 3, 6} {
+			if v := GetField(data, num); len(v) > len(data) {
+				t.Fatalf("field %d longer than the input", num)
+			}
+		}
+		DecodeMessage(data)
+	})
+}
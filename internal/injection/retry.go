@@ -0,0 +1,44 @@
+package injection
+
+import (
+	"errors"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const lockRetries = 5
+
+// lockRetryBackoff is the first pause between retries, doubled every attempt
+var lockRetryBackoff = 300 * time.Millisecond
+
+// isLocked reports whether err is SQLite telling us another process
+// (usually the IDE) is holding the database.
+func isLocked(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code() & 0xff // strip extended result code
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
+
+// retryLocked runs fn, retrying with a growing backoff while the database is locked.
+// fn must be safe to repeat, i.e. do all of its writes in a single transaction.
+func retryLocked(fn func() error) error {
+	backoff := lockRetryBackoff
+	var err error
+	for attempt := 0; attempt < lockRetries; attempt++ {
+		err = fn()
+		if err == nil || !isLocked(err) {
+			return err
+		}
+		if attempt == lockRetries-1 {
+			break // no point waiting when nothing retries after
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	return err
+}
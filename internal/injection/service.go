@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -17,18 +18,56 @@ type AuthStatus struct {
 	ApiKey string `json:"apiKey"`
 }
 
+// InjectMode decides what InjectIdentity does with an existing agentManagerInitState
+type InjectMode string
+
+const (
+	// ModeMerge swaps only the OAuthTokenInfo (field 6) and keeps every other
+	// field the IDE stored. It is the default.
+	ModeMerge InjectMode = "merge"
+	// ModeReplace writes a fresh value holding nothing but the token info
+	ModeReplace InjectMode = "replace"
+)
+
+// ParseInjectMode validates a mode name, empty meaning ModeMerge
+func ParseInjectMode(s string) (InjectMode, error) {
+	switch m := InjectMode(s); m {
+	case "":
+		return ModeMerge, nil
+	case ModeMerge, ModeReplace:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown inject mode %q (use merge or replace)", s)
+	}
+}
+
+// Identity is the account data InjectIdentity writes into the IDE database
+type Identity struct {
+	AccessToken  string
+	RefreshToken string
+	Email        string
+	Name         string
+	AvatarURL    string     // written to antigravity.profileUrl, deleted when empty
+	Expiry       time.Time  // access token expiry, zero when unknown
+	Mode         InjectMode // empty means ModeMerge
+}
+
+// Account is the identity SyncFromIDE finds signed in to the IDE
 type Account struct {
-	Name        string
-	Email       string
-	AccessToken string
+	Name         string // empty when the IDE has no antigravityAuthStatus
+	Email        string // likewise
+	AccessToken  string
+	RefreshToken string
+	Expiry       time.Time // zero when the token info carries none
+	AvatarURL    string
 }
 
 // SyncFromIDE retrieves the account info from the IDE database.
 func SyncFromIDE() (*Account, error) {
 	dbPath := utils.GetAntigravityDBPath()
-	db, err := sql.Open("sqlite", dbPath)
+	db, err := openDB(dbPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
 	defer db.Close()
 
@@ -43,58 +82,63 @@ func SyncFromIDE() (*Account, error) {
 		return nil, fmt.Errorf("failed to decode base64: %w", err)
 	}
 
-	accessToken, _, err := ExtractOAuthTokenInfo(data)
+	info, err := ReadOAuthTokenInfo(data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract token info: %w", err)
 	}
+	if info.AccessToken == "" {
+		return nil, errors.New("the IDE is not signed in")
+	}
+	account := &Account{
+		AccessToken:  info.AccessToken,
+		RefreshToken: info.RefreshToken,
+		Expiry:       info.Expiry,
+	}
 
-	// We might not be able to get Name/Email from the protobuf since we only extract token info.
-	// But we can try to find them in "antigravityAuthStatus" or just return stub/partial.
+	// Name and email are not part of the token info, antigravityAuthStatus has them
 	var authStatusJSON string
-	var name, email string
 	err = db.QueryRow("SELECT value FROM ItemTable WHERE key = ?", "antigravityAuthStatus").Scan(&authStatusJSON)
 	if err == nil {
 		var auth AuthStatus
 		if err := json.Unmarshal([]byte(authStatusJSON), &auth); err == nil {
-			name = auth.Name
-			email = auth.Email
+			account.Name = auth.Name
+			account.Email = auth.Email
 		}
 	}
+	db.QueryRow("SELECT value FROM ItemTable WHERE key = ?", "antigravity.profileUrl").Scan(&account.AvatarURL)
 
-	if email == "" {
-		email = "unknown@example.com"
-	}
-
-	return &Account{
-		Name:        name,
-		Email:       email,
-		AccessToken: accessToken,
-	}, nil
+	return account, nil
 }
 
 // InjectIdentity injects the access and refresh tokens into the antigravity database.
-// It creates a fresh protobuf structure with the new tokens.
-func InjectIdentity(dbPath, accessToken, refreshToken, email, name string) error {
-	// 1. Connect to SQLite
-	db, err := sql.Open("sqlite", dbPath)
-	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
-	}
-	defer db.Close()
-
-	// 2. AGGRESSIVE CLEANUP: Delete google.antigravity cache first
-	// This key often contains cached session data that could link accounts
-	_, _ = db.Exec("DELETE FROM ItemTable WHERE key = ?", "google.antigravity")
+// In merge mode only the token info of agentManagerInitState is replaced, in
+// replace mode (or when there is nothing to merge into) a fresh protobuf with
+// the new tokens is written. A value merge mode cannot decode is left alone
+// and ErrCannotMerge returned. The credential rows are snapshotted first; all
+// writes happen in one transaction, so a failure leaves nothing half-written.
+func InjectIdentity(dbPath string, id Identity) error {
+	return WithSnapshot(dbPath, "inject "+id.Email, func() error {
+		return injectIdentity(dbPath, id)
+	})
+}
 
-	// 3. Set default values for email/name if empty
-	if email == "" {
-		email = "user@antigravity.dev"
+// withDefaults fills in what the IDE needs but the identity may lack
+func (id Identity) withDefaults() Identity {
+	if id.Email == "" {
+		id.Email = "user@antigravity.dev"
 	}
-	if name == "" {
-		name = "Antigravity User"
+	if id.Name == "" {
+		id.Name = "Antigravity User"
 	}
+	return id
+}
+
+func injectIdentity(dbPath string, id Identity) error {
+	// 1. Set default values for email/name if empty
+	id = id.withDefaults()
+	accessToken, refreshToken := id.AccessToken, id.RefreshToken
+	email, name := id.Email, id.Name
 
-	// 4. Update antigravityAuthStatus with actual credentials
 	authStatus := AuthStatus{
 		Name:   name,
 		Email:  email,
@@ -105,39 +149,189 @@ func InjectIdentity(dbPath, accessToken, refreshToken, email, name string) error
 		return fmt.Errorf("failed to marshal auth status: %w", err)
 	}
 
-	_, err = db.Exec("INSERT OR REPLACE INTO ItemTable (key, value) VALUES (?, ?)", "antigravityAuthStatus", string(authBytes))
+	// 2. Token info expiry; when unknown assume a day, the IDE refreshes on a 401 anyway
+	expiry := id.Expiry.Unix()
+	if id.Expiry.IsZero() {
+		expiry = time.Now().Add(24 * time.Hour).Unix()
+	}
+
+	// 3. Write everything in one transaction, the IDE never sees half an identity
+	return withTx(dbPath, func(tx *sql.Tx) error {
+		newState, err := mergedState(tx, id.Mode, accessToken, refreshToken, expiry)
+		if err != nil {
+			return err
+		}
+		newBase64 := base64.StdEncoding.EncodeToString(newState)
+
+		// AGGRESSIVE CLEANUP: Delete google.antigravity cache first
+		// This key often contains cached session data that could link accounts
+		if _, err := tx.Exec("DELETE FROM ItemTable WHERE key = ?", "google.antigravity"); err != nil {
+			return fmt.Errorf("failed to delete google.antigravity: %w", err)
+		}
+
+		// Update antigravityAuthStatus with actual credentials
+		if _, err := tx.Exec("INSERT OR REPLACE INTO ItemTable (key, value) VALUES (?, ?)", "antigravityAuthStatus", string(authBytes)); err != nil {
+			return fmt.Errorf("failed to insert antigravityAuthStatus: %w", err)
+		}
+
+		// Force antigravityOnboarding to true to skip welcome dialogs
+		if _, err := tx.Exec("INSERT OR REPLACE INTO ItemTable (key, value) VALUES (?, ?)", "antigravityOnboarding", "true"); err != nil {
+			return fmt.Errorf("failed to insert antigravityOnboarding: %w", err)
+		}
+
+		// Profile avatar shown in the IDE's account menu; without one, don't
+		// leave the previous account's avatar next to the new name
+		if id.AvatarURL != "" {
+			if _, err := tx.Exec("INSERT OR REPLACE INTO ItemTable (key, value) VALUES (?, ?)", "antigravity.profileUrl", id.AvatarURL); err != nil {
+				return fmt.Errorf("failed to insert antigravity.profileUrl: %w", err)
+			}
+		} else if _, err := tx.Exec("DELETE FROM ItemTable WHERE key = ?", "antigravity.profileUrl"); err != nil {
+			return fmt.Errorf("failed to delete antigravity.profileUrl: %w", err)
+		}
+
+		// Insert or replace the protobuf record
+		if _, err := tx.Exec("INSERT OR REPLACE INTO ItemTable (key, value) VALUES (?, ?)", "jetskiStateSync.agentManagerInitState", newBase64); err != nil {
+			return fmt.Errorf("failed to insert protobuf: %w", err)
+		}
+		return nil
+	})
+}
+
+// ErrCannotMerge means merge mode found an agentManagerInitState it cannot
+// decode. Writing a fresh value would drop whatever else the IDE stored in it,
+// so that takes replace mode.
+var ErrCannotMerge = errors.New("the IDE's agentManagerInitState cannot be merged into, use inject --replace or set ide.inject_mode to replace")
+
+// mergedState builds the new agentManagerInitState. Merge mode keeps the
+// current value's other fields; a missing or empty value has nothing worth
+// keeping and gets a fresh one, as in replace mode. An undecodable value is
+// ErrCannotMerge.
+func mergedState(tx *sql.Tx, mode InjectMode, accessToken, refreshToken string, expiry int64) ([]byte, error) {
+	fresh := CreateOAuthTokenInfo(accessToken, refreshToken, expiry)
+
+	switch mode {
+	case ModeReplace:
+		return fresh, nil
+	case "", ModeMerge:
+	default:
+		return nil, fmt.Errorf("unknown inject mode %q", mode)
+	}
+
+	var stateBase64 string
+	err := tx.QueryRow("SELECT value FROM ItemTable WHERE key = ?", "jetskiStateSync.agentManagerInitState").Scan(&stateBase64)
+	if err == sql.ErrNoRows {
+		return fresh, nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to insert antigravityAuthStatus: %w", err)
+		return nil, fmt.Errorf("failed to read agentManagerInitState: %w", err)
 	}
 
-	// 5. Force antigravityOnboarding to true to skip welcome dialogs
-	_, err = db.Exec("INSERT OR REPLACE INTO ItemTable (key, value) VALUES (?, ?)", "antigravityOnboarding", "true")
+	data, err := base64.StdEncoding.DecodeString(stateBase64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCannotMerge, err)
+	}
+	if len(data) == 0 {
+		return fresh, nil
+	}
+	merged, err := replaceProtobufField6(data, accessToken, refreshToken, expiry)
 	if err != nil {
-		return fmt.Errorf("failed to insert antigravityOnboarding: %w", err)
+		return nil, fmt.Errorf("%w: %v", ErrCannotMerge, err)
 	}
+	return merged, nil
+}
 
-	// 6. Create fresh protobuf with OAuth tokens
-	expiry := time.Now().Add(24 * time.Hour).Unix()
-	newProtobuf := CreateOAuthTokenInfo(accessToken, refreshToken, expiry)
-	newBase64 := base64.StdEncoding.EncodeToString(newProtobuf)
+// UpdateTokens refreshes the OAuth token info of an already injected identity.
+// Unlike InjectIdentity it keeps every other field of agentManagerInitState and
+// the name/email in antigravityAuthStatus, only swapping the token and expiry.
+// A locked database is retried a few times before giving up; a failed update
+// rolls back its transaction and leaves what the IDE wrote meanwhile alone.
+func UpdateTokens(dbPath, accessToken, refreshToken string, expiry int64) error {
+	return WithSnapshot(dbPath, "token refresh", func() error {
+		return withTx(dbPath, func(tx *sql.Tx) error {
+			return updateTokens(tx, accessToken, refreshToken, expiry)
+		})
+	})
+}
 
-	// 7. Insert or replace the protobuf record
-	_, err = db.Exec("INSERT OR REPLACE INTO ItemTable (key, value) VALUES (?, ?)", "jetskiStateSync.agentManagerInitState", newBase64)
+func updateTokens(tx *sql.Tx, accessToken, refreshToken string, expiry int64) error {
+	var stateBase64 string
+	err := tx.QueryRow("SELECT value FROM ItemTable WHERE key = ?", "jetskiStateSync.agentManagerInitState").Scan(&stateBase64)
 	if err != nil {
-		return fmt.Errorf("failed to insert protobuf: %w", err)
+		return fmt.Errorf("failed to read agentManagerInitState: %w", err)
 	}
 
+	data, err := base64.StdEncoding.DecodeString(stateBase64)
+	if err != nil {
+		return fmt.Errorf("failed to decode base64: %w", err)
+	}
+
+	newState, err := replaceProtobufField6(data, accessToken, refreshToken, expiry)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE ItemTable SET value = ? WHERE key = ?", base64.StdEncoding.EncodeToString(newState), "jetskiStateSync.agentManagerInitState")
+	if err != nil {
+		return fmt.Errorf("failed to update protobuf: %w", err)
+	}
+
+	// Keep the API key in antigravityAuthStatus in sync, leaving name/email as they are
+	var authStatusJSON string
+	err = tx.QueryRow("SELECT value FROM ItemTable WHERE key = ?", "antigravityAuthStatus").Scan(&authStatusJSON)
+	if err == nil {
+		var status AuthStatus
+		if json.Unmarshal([]byte(authStatusJSON), &status) == nil && status.Email != "" {
+			status.ApiKey = accessToken
+			authBytes, err := json.Marshal(status)
+			if err != nil {
+				return fmt.Errorf("failed to marshal auth status: %w", err)
+			}
+			if _, err := tx.Exec("UPDATE ItemTable SET value = ? WHERE key = ?", string(authBytes), "antigravityAuthStatus"); err != nil {
+				return fmt.Errorf("failed to update antigravityAuthStatus: %w", err)
+			}
+		}
+	} else if err != sql.ErrNoRows {
+		return fmt.Errorf("failed to read antigravityAuthStatus: %w", err)
+	}
 	return nil
 }
 
-func replaceProtobufField6(data []byte, accessToken, refreshToken string) []byte {
+// ClearIdentity signs the IDE out the way the app itself does: the avatar and
+// google.antigravity cache are deleted, antigravityAuthStatus becomes the
+// string "null" and agentManagerInitState the minimal protobuf "mgEA". The
+// rows are snapshotted first and written in one transaction.
+func ClearIdentity(dbPath string) error {
+	return WithSnapshot(dbPath, "sign out", func() error {
+		return withTx(dbPath, func(tx *sql.Tx) error {
+			steps := []struct {
+				query string
+				args  []interface{}
+			}{
+				{"DELETE FROM ItemTable WHERE key = ?", []interface{}{"antigravity.profileUrl"}},
+				// "null" string, not NULL!
+				{"UPDATE ItemTable SET value = ? WHERE key = ?", []interface{}{"null", "antigravityAuthStatus"}},
+				{"UPDATE ItemTable SET value = ? WHERE key = ?", []interface{}{"mgEA", "jetskiStateSync.agentManagerInitState"}},
+				{"DELETE FROM ItemTable WHERE key = ?", []interface{}{"google.antigravity"}},
+			}
+			for _, step := range steps {
+				if _, err := tx.Exec(step.query, step.args...); err != nil {
+					return fmt.Errorf("failed to clear IDE credentials: %w", err)
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// replaceProtobufField6 swaps the OAuthTokenInfo (field 6) of an agentManagerInitState
+// message, keeping all other fields untouched.
+func replaceProtobufField6(data []byte, accessToken, refreshToken string, expiry int64) ([]byte, error) {
 	cleanData, err := RemoveField(data, 6)
 	if err != nil {
-		fmt.Printf("Warning: RemoveField error: %v\n", err)
+		return nil, fmt.Errorf("failed to strip old token info: %w", err)
 	}
 
-	expiry := time.Now().Add(24 * time.Hour).Unix()
 	newField := CreateOAuthTokenInfo(accessToken, refreshToken, expiry)
 
-	return append(cleanData, newField...)
+	return append(cleanData, newField...), nil
 }
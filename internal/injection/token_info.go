@@ -0,0 +1,143 @@
+package injection
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// tokenInfoField is the agentManagerInitState field holding OAuthTokenInfo
+const tokenInfoField = 6
+
+// ErrNoTokenInfo means agentManagerInitState has no OAuthTokenInfo, e.g.
+// after a sign out
+var ErrNoTokenInfo = errors.New("field 6 (OAuthTokenInfo) not found")
+
+// OAuthTokenInfo is field 6 of agentManagerInitState:
+//
+//	1: access token   string
+//	2: token type     string ("Bearer")
+//	3: refresh token  string
+//	4: expiry         google.protobuf.Timestamp {1: seconds, 2: nanos}
+type OAuthTokenInfo struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	Expiry       time.Time // zero when the field is absent
+
+	// unknown keeps fields this model does not know. Marshal writes them after
+	// the known fields and always writes fields 1-3, so Marshal(Unmarshal(b))
+	// decodes to the same message as b but need not be the same bytes.
+	unknown []byte
+}
+
+// Marshal encodes the message body, without the field 6 wrapper
+func (t OAuthTokenInfo) Marshal() []byte {
+	var b []byte
+	b = AppendBytesField(b, 1, []byte(t.AccessToken))
+	b = AppendBytesField(b, 2, []byte(t.TokenType))
+	b = AppendBytesField(b, 3, []byte(t.RefreshToken))
+	if !t.Expiry.IsZero() {
+		var ts []byte
+		ts = AppendVarintField(ts, 1, uint64(t.Expiry.Unix()))
+		if nanos := t.Expiry.Nanosecond(); nanos != 0 {
+			ts = AppendVarintField(ts, 2, uint64(nanos))
+		}
+		b = AppendBytesField(b, 4, ts)
+	}
+	return append(b, t.unknown...)
+}
+
+// Unmarshal decodes a message body as produced by Marshal
+func (t *OAuthTokenInfo) Unmarshal(data []byte) error {
+	*t = OAuthTokenInfo{}
+	offset := 0
+	for offset < len(data) {
+		num, wireType, next, err := ReadTag(data, offset)
+		if err != nil {
+			return err
+		}
+		end, err := skipField(data, next, num, wireType, 0)
+		if err != nil {
+			return err
+		}
+
+		if num >= 1 && num <= 4 && wireType != WireBytes {
+			return fmt.Errorf("OAuthTokenInfo field %d: %w", num, ErrWireType)
+		}
+		switch num {
+		case 1:
+			t.AccessToken = string(lengthDelimited(data, next))
+		case 2:
+			t.TokenType = string(lengthDelimited(data, next))
+		case 3:
+			t.RefreshToken = string(lengthDelimited(data, next))
+		case 4:
+			expiry, err := unmarshalTimestamp(lengthDelimited(data, next))
+			if err != nil {
+				return fmt.Errorf("OAuthTokenInfo expiry: %w", err)
+			}
+			t.Expiry = expiry
+		default:
+			t.unknown = append(t.unknown, data[offset:end]...)
+		}
+		offset = end
+	}
+	return nil
+}
+
+// lengthDelimited returns the value of a length-delimited field whose length
+// starts at offset; the caller has already bounds-checked it with skipField
+func lengthDelimited(data []byte, offset int) []byte {
+	length, start, _ := ReadVarint(data, offset)
+	return data[start : start+int(length)]
+}
+
+func unmarshalTimestamp(data []byte) (time.Time, error) {
+	var seconds, nanos uint64
+	offset := 0
+	for offset < len(data) {
+		num, wireType, next, err := ReadTag(data, offset)
+		if err != nil {
+			return time.Time{}, err
+		}
+		end, err := skipField(data, next, num, wireType, 0)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if wireType == WireVarint && (num == 1 || num == 2) {
+			v, _, _ := ReadVarint(data, next)
+			if num == 1 {
+				seconds = v
+			} else {
+				nanos = v
+			}
+		}
+		offset = end
+	}
+	if nanos >= 1e9 {
+		return time.Time{}, fmt.Errorf("nanos %d out of range", nanos)
+	}
+	return time.Unix(int64(seconds), int64(nanos)), nil
+}
+
+// UnixExpiry converts a stored Unix expiry to a time, 0 meaning unknown
+func UnixExpiry(ts int64) time.Time {
+	if ts == 0 {
+		return time.Time{}
+	}
+	return time.Unix(ts, 0)
+}
+
+// ReadOAuthTokenInfo decodes the OAuthTokenInfo held in an agentManagerInitState value
+func ReadOAuthTokenInfo(state []byte) (*OAuthTokenInfo, error) {
+	field := GetField(state, tokenInfoField)
+	if field == nil {
+		return nil, ErrNoTokenInfo
+	}
+	var info OAuthTokenInfo
+	if err := info.Unmarshal(field); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
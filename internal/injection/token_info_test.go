@@ -0,0 +1,93 @@
+package injection
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestOAuthTokenInfo_RoundTrip(t *testing.T) {
+	in := OAuthTokenInfo{
+		AccessToken:  "access",
+		TokenType:    "Bearer",
+		RefreshToken: "refresh",
+		Expiry:       time.Unix(1767225600, 123456789),
+	}
+	var out OAuthTokenInfo
+	if err := out.Unmarshal(in.Marshal()); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if out.AccessToken != in.AccessToken || out.TokenType != in.TokenType || out.RefreshToken != in.RefreshToken {
+		t.Errorf("strings changed: %+v", out)
+	}
+	if !out.Expiry.Equal(in.Expiry) {
+		t.Errorf("expiry changed: got %v, want %v", out.Expiry, in.Expiry)
+	}
+}
+
+func TestOAuthTokenInfo_KeepsUnknownFields(t *testing.T) {
+	data := OAuthTokenInfo{AccessToken: "a", TokenType: "Bearer", RefreshToken: "r"}.Marshal()
+	data = AppendBytesField(data, 7, []byte("id_token"))
+	data = AppendVarintField(data, 9, 1)
+
+	var info OAuthTokenInfo
+	if err := info.Unmarshal(data); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !info.Expiry.IsZero() {
+		t.Errorf("expected zero expiry without field 4, got %v", info.Expiry)
+	}
+	if got := info.Marshal(); !bytes.Equal(got, data) {
+		t.Errorf("round trip changed bytes:\n got %x\nwant %x", got, data)
+	}
+}
+
+func TestOAuthTokenInfo_NonCanonicalInputIsEquivalent(t *testing.T) {
+	// Unknown field first, no token type, refresh token before access token
+	var data []byte
+	data = AppendBytesField(data, 7, []byte("id_token"))
+	data = AppendBytesField(data, 3, []byte("r"))
+	data = AppendBytesField(data, 1, []byte("a"))
+
+	var first, second OAuthTokenInfo
+	if err := first.Unmarshal(data); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if err := second.Unmarshal(first.Marshal()); err != nil {
+		t.Fatalf("Unmarshal of Marshal output failed: %v", err)
+	}
+	if first.AccessToken != second.AccessToken || first.TokenType != second.TokenType ||
+		first.RefreshToken != second.RefreshToken || !first.Expiry.Equal(second.Expiry) ||
+		!bytes.Equal(first.unknown, second.unknown) {
+		t.Errorf("round trip changed the message: %+v vs %+v", first, second)
+	}
+	if GetField(first.Marshal(), 7) == nil {
+		t.Error("unknown field lost")
+	}
+}
+
+func TestInjectIdentity_WritesRealExpiry(t *testing.T) {
+	dbPath := createTempDB(t)
+	expiry := time.Unix(1767225600, 0)
+
+	err := InjectIdentity(dbPath, Identity{AccessToken: "a", RefreshToken: "r", Expiry: expiry})
+	if err != nil {
+		t.Fatalf("InjectIdentity failed: %v", err)
+	}
+
+	db, _ := sql.Open("sqlite", dbPath)
+	defer db.Close()
+	var val string
+	db.QueryRow("SELECT value FROM ItemTable WHERE key = ?", "jetskiStateSync.agentManagerInitState").Scan(&val)
+	decoded, _ := base64.StdEncoding.DecodeString(val)
+
+	info, err := ReadOAuthTokenInfo(decoded)
+	if err != nil {
+		t.Fatalf("ReadOAuthTokenInfo failed: %v", err)
+	}
+	if !info.Expiry.Equal(expiry) || info.TokenType != "Bearer" {
+		t.Errorf("unexpected token info: %+v", info)
+	}
+}
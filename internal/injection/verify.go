@@ -0,0 +1,100 @@
+package injection
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Mismatch is one value the IDE database holds differently from the identity
+type Mismatch struct {
+	Field string
+	Want  string
+	Got   string
+}
+
+// VerifyError lists everything that did not match after an injection
+type VerifyError struct {
+	Mismatches []Mismatch
+}
+
+func (e *VerifyError) Error() string {
+	parts := make([]string, 0, len(e.Mismatches))
+	for _, m := range e.Mismatches {
+		parts = append(parts, fmt.Sprintf("%s: want %s, got %s", m.Field, m.Want, m.Got))
+	}
+	return "IDE database does not hold the injected identity: " + strings.Join(parts, "; ")
+}
+
+// VerifyIdentity re-reads antigravityAuthStatus and agentManagerInitState and
+// compares the access token, refresh token, email and expiry with id. A
+// mismatch is returned as a *VerifyError; tokens in it are masked.
+func VerifyIdentity(dbPath string, id Identity) error {
+	id = id.withDefaults()
+
+	authJSON, ok, err := ReadItem(dbPath, "antigravityAuthStatus")
+	if err != nil {
+		return err
+	}
+	// "null" after a sign out or unparseable leaves status empty, which the
+	// comparisons below report
+	var status AuthStatus
+	if ok {
+		json.Unmarshal([]byte(authJSON), &status)
+	}
+
+	stateBase64, _, err := ReadItem(dbPath, "jetskiStateSync.agentManagerInitState")
+	if err != nil {
+		return err
+	}
+	var info OAuthTokenInfo
+	if data, err := base64.StdEncoding.DecodeString(stateBase64); err == nil {
+		if got, err := ReadOAuthTokenInfo(data); err == nil {
+			info = *got
+		}
+	}
+
+	var mismatches []Mismatch
+	check := func(field, want, got string, mask bool) {
+		if want == got {
+			return
+		}
+		if mask {
+			want, got = MaskToken(want), MaskToken(got)
+		}
+		mismatches = append(mismatches, Mismatch{Field: field, Want: want, Got: got})
+	}
+	check("email", id.Email, status.Email, false)
+	check("apiKey", id.AccessToken, status.ApiKey, true)
+	check("access token", id.AccessToken, info.AccessToken, true)
+	check("refresh token", id.RefreshToken, info.RefreshToken, true)
+	if !id.Expiry.IsZero() {
+		check("expiry", formatExpiry(id.Expiry), formatExpiry(info.Expiry), false)
+	}
+
+	if len(mismatches) > 0 {
+		return &VerifyError{Mismatches: mismatches}
+	}
+	return nil
+}
+
+func formatExpiry(t time.Time) string {
+	if t.IsZero() {
+		return "(none)"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// MaskToken shortens a token to something safe to print that still tells two
+// tokens apart
+func MaskToken(token string) string {
+	if token == "" {
+		return "(empty)"
+	}
+	if len(token) <= 12 {
+		return fmt.Sprintf("*** (%d chars)", len(token))
+	}
+	return fmt.Sprintf("%s…%s (%d chars)", token[:6], token[len(token)-4:], len(token))
+}
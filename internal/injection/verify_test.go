@@ -0,0 +1,62 @@
+package injection
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyIdentity(t *testing.T) {
+	dbPath := createTempDB(t)
+	id := Identity{
+		AccessToken:  "ya29.access-token-value",
+		RefreshToken: "1//refresh-token-value",
+		Email:        "user@example.com",
+		Name:         "User",
+		Expiry:       time.Unix(1767225600, 0),
+	}
+	if err := InjectIdentity(dbPath, id); err != nil {
+		t.Fatalf("InjectIdentity failed: %v", err)
+	}
+	if err := VerifyIdentity(dbPath, id); err != nil {
+		t.Fatalf("VerifyIdentity after injection: %v", err)
+	}
+
+	// The IDE overwriting the token, e.g. on exit, must be caught
+	other := id
+	other.AccessToken = "ya29.someone-elses-token"
+	if err := UpdateTokens(dbPath, other.AccessToken, id.RefreshToken, id.Expiry.Unix()); err != nil {
+		t.Fatalf("UpdateTokens failed: %v", err)
+	}
+
+	err := VerifyIdentity(dbPath, id)
+	var verifyErr *VerifyError
+	if !errors.As(err, &verifyErr) {
+		t.Fatalf("expected *VerifyError, got %v", err)
+	}
+	fields := map[string]bool{}
+	for _, m := range verifyErr.Mismatches {
+		fields[m.Field] = true
+	}
+	if len(fields) != 2 || !fields["access token"] || !fields["apiKey"] {
+		t.Errorf("expected access token and apiKey mismatches, got %+v", verifyErr.Mismatches)
+	}
+	if strings.Contains(err.Error(), id.AccessToken) || strings.Contains(err.Error(), other.AccessToken) {
+		t.Errorf("tokens must be masked in %q", err)
+	}
+}
+
+func TestVerifyIdentity_SignedOut(t *testing.T) {
+	dbPath := createTempDB(t)
+	db, _ := sql.Open("sqlite", dbPath)
+	db.Exec("INSERT INTO ItemTable (key, value) VALUES ('antigravityAuthStatus', 'null'), ('jetskiStateSync.agentManagerInitState', 'mgEA')")
+	db.Close()
+
+	err := VerifyIdentity(dbPath, Identity{AccessToken: "a", RefreshToken: "r", Email: "user@example.com"})
+	var verifyErr *VerifyError
+	if !errors.As(err, &verifyErr) || len(verifyErr.Mismatches) != 4 {
+		t.Fatalf("expected 4 mismatches for a signed-out IDE, got %v", err)
+	}
+}
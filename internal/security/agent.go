@@ -0,0 +1,226 @@
+package security
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The key agent holds the unlocked master key in memory for a limited time so
+// that a passphrase has to be typed once per working session rather than once
+// per command, in the spirit of ssh-agent. It listens on a unix socket in a
+// directory only the current user can enter, and both ends check that the
+// other one runs as the same user.
+
+type agentRequest struct {
+	Op  string `json:"op"` // get, put, lock, stop
+	Key []byte `json:"key,omitempty"`
+}
+
+type agentResponse struct {
+	Key   []byte `json:"key,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ErrAgentLocked is returned when the agent runs but holds no key
+var ErrAgentLocked = errors.New("agent holds no key")
+
+// AgentSocketPath returns where the agent listens for the current user
+func AgentSocketPath() string {
+	return filepath.Join(agentDir(), "agent.sock")
+}
+
+// agentDir is the private directory holding the socket. Without
+// XDG_RUNTIME_DIR it lives in the shared temp directory, where another user
+// may have created it first; checkAgentDir catches that.
+func agentDir() string {
+	base := os.Getenv("XDG_RUNTIME_DIR")
+	if base == "" {
+		base = os.TempDir()
+	}
+	return filepath.Join(base, fmt.Sprintf("antigravity-cli-agent-%d", os.Getuid()))
+}
+
+// prepareAgentDir creates the socket directory if needed and checks that it
+// is ours and closed to everybody else
+func prepareAgentDir() error {
+	dir := agentDir()
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create agent directory: %w", err)
+	}
+	return checkAgentDir(dir)
+}
+
+// RunAgent serves the key agent until it is stopped. A key put into the agent
+// is forgotten again after ttl.
+func RunAgent(ttl time.Duration) error {
+	socketPath := AgentSocketPath()
+	if err := prepareAgentDir(); err != nil {
+		return err
+	}
+
+	if _, err := agentCall(agentRequest{Op: "get"}); err == nil || errors.Is(err, ErrAgentLocked) {
+		return fmt.Errorf("an agent is already running on %s", socketPath)
+	}
+	os.Remove(socketPath) // stale socket from a crashed agent
+
+	listener, err := listenAgent(socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+	defer listener.Close()
+	defer os.Remove(socketPath)
+
+	var (
+		mu      sync.Mutex
+		key     []byte
+		expires time.Time
+	)
+	stop := make(chan struct{})
+
+	go func() {
+		<-stop
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+			if err := checkPeer(conn); err != nil {
+				return
+			}
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			var req agentRequest
+			if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+				return
+			}
+
+			var resp agentResponse
+			mu.Lock()
+			if key != nil && time.Now().After(expires) {
+				key = nil
+			}
+			switch req.Op {
+			case "get":
+				if key == nil {
+					resp.Error = ErrAgentLocked.Error()
+				} else {
+					resp.Key = key
+				}
+			case "put":
+				key = req.Key
+				expires = time.Now().Add(ttl)
+			case "lock":
+				key = nil
+			case "stop":
+				key = nil
+				select {
+				case <-stop:
+				default:
+					close(stop)
+				}
+			default:
+				resp.Error = fmt.Sprintf("unknown op %q", req.Op)
+			}
+			mu.Unlock()
+
+			json.NewEncoder(conn).Encode(resp)
+		}(conn)
+	}
+}
+
+func agentCall(req agentRequest) (*agentResponse, error) {
+	if err := checkAgentDir(agentDir()); err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("unix", AgentSocketPath(), time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := checkPeer(conn); err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	var resp agentResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Error == ErrAgentLocked.Error() {
+		return nil, ErrAgentLocked
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+func agentGet() ([]byte, error) {
+	resp, err := agentCall(agentRequest{Op: "get"})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Key) != keySize {
+		return nil, ErrAgentLocked
+	}
+	return resp.Key, nil
+}
+
+func agentPut(key []byte) error {
+	_, err := agentCall(agentRequest{Op: "put", Key: key})
+	return err
+}
+
+// AgentStatus reports whether an agent is running and whether it holds a key
+func AgentStatus() (running bool, unlocked bool) {
+	_, err := agentCall(agentRequest{Op: "get"})
+	if err == nil {
+		return true, true
+	}
+	return errors.Is(err, ErrAgentLocked), false
+}
+
+// Unlock unlocks the master key now and hands it to the agent
+func Unlock() error {
+	key, err := GetKey()
+	if err != nil {
+		return err
+	}
+	return agentPut(key)
+}
+
+// Lock makes the agent forget the key and drops this process's cached copy
+func Lock() error {
+	mu.Lock()
+	cachedKey = nil
+	mu.Unlock()
+	_, err := agentCall(agentRequest{Op: "lock"})
+	return err
+}
+
+// StopAgent shuts a running agent down
+func StopAgent() error {
+	_, err := agentCall(agentRequest{Op: "stop"})
+	return err
+}
@@ -0,0 +1,122 @@
+//go:build !windows
+
+package security
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startTestAgent runs an agent in a private XDG_RUNTIME_DIR until the test ends
+func startTestAgent(t *testing.T) {
+	t.Helper()
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	done := make(chan error, 1)
+	go func() { done <- RunAgent(time.Hour) }()
+	t.Cleanup(func() {
+		StopAgent()
+		<-done
+	})
+
+	for i := 0; i < 100; i++ {
+		if running, _ := AgentStatus(); running {
+			return
+		}
+		select {
+		case err := <-done:
+			t.Fatalf("RunAgent failed: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatal("agent did not start")
+}
+
+func TestAgent_PutGetLock(t *testing.T) {
+	startTestAgent(t)
+
+	info, err := os.Stat(AgentSocketPath())
+	if err != nil {
+		t.Fatalf("socket missing: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		t.Errorf("socket is accessible by others: %o", perm)
+	}
+
+	key, _ := GenerateKey()
+	if err := agentPut(key); err != nil {
+		t.Fatalf("agentPut failed: %v", err)
+	}
+	got, err := agentGet()
+	if err != nil || !bytes.Equal(got, key) {
+		t.Fatalf("agentGet returned %x, %v", got, err)
+	}
+
+	if err := Lock(); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if _, unlocked := AgentStatus(); unlocked {
+		t.Error("agent still unlocked after Lock")
+	}
+}
+
+func TestAgent_RejectsForeignDirectory(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	// Somebody else got there first and left the directory open
+	if err := os.Mkdir(agentDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunAgent(time.Hour); err == nil {
+		t.Fatal("expected RunAgent to refuse a directory others can enter")
+	}
+	if _, err := agentCall(agentRequest{Op: "get"}); err == nil {
+		t.Fatal("expected agentCall to refuse a directory others can enter")
+	}
+
+	os.Remove(agentDir())
+	if err := os.Symlink(t.TempDir(), agentDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunAgent(time.Hour); err == nil {
+		t.Fatal("expected RunAgent to refuse a symlinked directory")
+	}
+}
+
+func TestGetKey_RejectsAgentKeyWithOtherID(t *testing.T) {
+	startTestAgent(t)
+
+	dir := t.TempDir()
+	if err := Init(filepath.Join(dir, "key.json")); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	provider := keyFileProvider{path: filepath.Join(dir, "master.key")}
+	key, err := provider.LoadKey()
+	if err != nil {
+		t.Fatalf("LoadKey failed: %v", err)
+	}
+	cfg := KeyConfig{Provider: ProviderKeyFile, KeyFile: provider.path, UseAgent: true, KeyID: KeyID(key)}
+	if err := SaveConfig(cfg); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	planted, _ := GenerateKey()
+	if err := agentPut(planted); err != nil {
+		t.Fatalf("agentPut failed: %v", err)
+	}
+
+	got, err := GetKey()
+	if err != nil {
+		t.Fatalf("GetKey failed: %v", err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Fatal("GetKey accepted a key from the agent that is not the master key")
+	}
+	// The real key replaced the planted one in the agent
+	if inAgent, _ := agentGet(); !bytes.Equal(inAgent, key) {
+		t.Error("agent was not given the real key")
+	}
+}
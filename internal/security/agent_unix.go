@@ -0,0 +1,37 @@
+//go:build !windows
+
+package security
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// checkAgentDir makes sure dir is a real directory owned by the current user
+// that nobody else can enter, so the socket in it cannot be someone else's
+func checkAgentDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("agent directory %s is not a directory", dir)
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("agent directory %s belongs to uid %d, not to you", dir, st.Uid)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("agent directory %s is accessible by others (mode %o)", dir, info.Mode().Perm())
+	}
+	return nil
+}
+
+// listenAgent creates the socket with mode 0600 from the start, there is no
+// window in which others could connect
+func listenAgent(socketPath string) (net.Listener, error) {
+	old := syscall.Umask(0177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", socketPath)
+}
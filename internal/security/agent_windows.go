@@ -0,0 +1,26 @@
+//go:build windows
+
+package security
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// checkAgentDir makes sure dir is a real directory. Windows has no owner bits
+// to check; the directory inherits the ACL of the user's temp directory.
+func checkAgentDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("agent directory %s is not a directory", dir)
+	}
+	return nil
+}
+
+func listenAgent(socketPath string) (net.Listener, error) {
+	return net.Listen("unix", socketPath)
+}
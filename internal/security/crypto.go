@@ -4,99 +4,165 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
-
-	"github.com/zalando/go-keyring"
 )
 
 const (
 	serviceName = "antigravity-cli"
 	userName    = "master-key"
+
+	keySize = 32 // AES-256
 )
 
-// GetKey retrieves the master encryption key from the system keyring.
-// If it doesn't exist, it generates a new one and saves it.
+// GetKey returns the master encryption key from the configured key provider.
+// The key is unlocked once per process (or fetched from the key agent) and
+// kept in memory afterwards.
 func GetKey() ([]byte, error) {
-	// Try to get the key from the keyring
-	keyStr, err := keyring.Get(serviceName, userName)
-	if err == nil {
-		return base64.StdEncoding.DecodeString(keyStr)
+	mu.Lock()
+	defer mu.Unlock()
+
+	if cachedKey != nil {
+		return cachedKey, nil
 	}
 
-	// If not found, generate a new key
-	if errors.Is(err, keyring.ErrNotFound) {
-		newKey := make([]byte, 32) // AES-256
-		if _, err := io.ReadFull(rand.Reader, newKey); err != nil {
-			return nil, fmt.Errorf("failed to generate random key: %w", err)
+	if keyConfig.UseAgent && keyConfig.KeyID != "" {
+		// Only trust the agent with the key we know; anything else came from
+		// an agent that is not ours or is out of date
+		if key, err := agentGet(); err == nil && KeyID(key) == keyConfig.KeyID {
+			cachedKey = key
+			return key, nil
 		}
+	}
 
-		keyBase64 := base64.StdEncoding.EncodeToString(newKey)
-		if err := keyring.Set(serviceName, userName, keyBase64); err != nil {
-			return nil, fmt.Errorf("failed to save key to keyring: %w", err)
-		}
+	provider, err := newProvider(keyConfig)
+	if err != nil {
+		return nil, err
+	}
+	key, err := provider.LoadKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("master key from %s has invalid length %d", provider.Name(), len(key))
+	}
 
-		return newKey, nil
+	if keyConfig.UseAgent {
+		if keyConfig.KeyID == "" {
+			// key.json from before key IDs: record it, so the agent can be checked
+			cfg := keyConfig
+			cfg.KeyID = KeyID(key)
+			saveConfigNoLock(cfg)
+		}
+		// Best effort: without a running agent the key is simply unlocked again next time
+		agentPut(key)
 	}
 
-	return nil, fmt.Errorf("failed to retrieve key from keyring: %w", err)
+	cachedKey = key
+	return key, nil
+}
+
+// GenerateKey returns a new random AES-256 master key
+func GenerateKey() ([]byte, error) {
+	newKey := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, newKey); err != nil {
+		return nil, fmt.Errorf("failed to generate random key: %w", err)
+	}
+	return newKey, nil
 }
 
-// Encrypt encrypts data using AES-GCM.
+// Encrypt encrypts data with the master key using AES-GCM.
 func Encrypt(data []byte) ([]byte, error) {
 	key, err := GetKey()
 	if err != nil {
 		return nil, err
 	}
-
-	block, err := aes.NewCipher(key)
+	aead, err := masterAEAD(key)
 	if err != nil {
 		return nil, err
 	}
+	return seal(aead, data)
+}
 
-	aesGCM, err := cipher.NewGCM(block)
+// Decrypt decrypts data with the master key using AES-GCM.
+func Decrypt(data []byte) ([]byte, error) {
+	key, err := GetKey()
 	if err != nil {
 		return nil, err
 	}
-
-	nonce := make([]byte, aesGCM.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+	aead, err := masterAEAD(key)
+	if err != nil {
 		return nil, err
 	}
+	return open(aead, data)
+}
 
-	ciphertext := aesGCM.Seal(nonce, nonce, data, nil)
-	return ciphertext, nil
+// EncryptWithKey encrypts data using AES-GCM with an explicit key.
+// The random nonce is prepended to the ciphertext.
+func EncryptWithKey(key, data []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return seal(aead, data)
 }
 
-// Decrypt decrypts data using AES-GCM.
-func Decrypt(data []byte) ([]byte, error) {
-	key, err := GetKey()
+// DecryptWithKey decrypts data produced by EncryptWithKey.
+func DecryptWithKey(key, data []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
 	if err != nil {
 		return nil, err
 	}
+	return open(aead, data)
+}
 
+func newAEAD(key []byte) (cipher.AEAD, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
+	return cipher.NewGCM(block)
+}
 
-	aesGCM, err := cipher.NewGCM(block)
+// masterAEAD returns the AEAD for a master key, building it only once per
+// process. There are at most two master keys in use (current and pending).
+func masterAEAD(key []byte) (cipher.AEAD, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if aead, ok := aeadCache[string(key)]; ok {
+		return aead, nil
+	}
+	aead, err := newAEAD(key)
 	if err != nil {
 		return nil, err
 	}
+	if aeadCache == nil {
+		aeadCache = make(map[string]cipher.AEAD)
+	}
+	aeadCache[string(key)] = aead
+	return aead, nil
+}
+
+func seal(aead cipher.AEAD, data []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
 
-	nonceSize := aesGCM.NonceSize()
+func open(aead cipher.AEAD, data []byte) ([]byte, error) {
+	nonceSize := aead.NonceSize()
 	if len(data) < nonceSize {
 		return nil, errors.New("ciphertext too short")
 	}
 
 	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
-	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt: %w", err)
 	}
-
 	return plaintext, nil
 }
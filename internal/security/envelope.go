@@ -0,0 +1,51 @@
+package security
+
+// Envelope encryption: each profile's secrets are encrypted with their own
+// random data key, and only that short data key is encrypted ("wrapped") with
+// the master key. Unchanged profiles keep their ciphertext across saves, and
+// rotating the master key only re-wraps data keys.
+
+// NewDataKey returns a fresh random data-encryption key
+func NewDataKey() ([]byte, error) {
+	return GenerateKey()
+}
+
+// WrapKey encrypts a data key with the master key and returns the master key's ID
+func WrapKey(dataKey []byte) (wrapped []byte, keyID string, err error) {
+	master, err := GetKey()
+	if err != nil {
+		return nil, "", err
+	}
+	return WrapKeyWith(master, dataKey)
+}
+
+// WrapKeyWith encrypts a data key with an explicit master key
+func WrapKeyWith(master, dataKey []byte) (wrapped []byte, keyID string, err error) {
+	aead, err := masterAEAD(master)
+	if err != nil {
+		return nil, "", err
+	}
+	wrapped, err = seal(aead, dataKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return wrapped, KeyID(master), nil
+}
+
+// UnwrapKey decrypts a data key wrapped by the master key with the given ID
+func UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	master, err := KeyForID(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return UnwrapKeyWith(master, wrapped)
+}
+
+// UnwrapKeyWith decrypts a data key with an explicit master key
+func UnwrapKeyWith(master, wrapped []byte) ([]byte, error) {
+	aead, err := masterAEAD(master)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, wrapped)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package security
+
+import "net"
+
+// checkPeer relies on the private agent directory where peer credentials
+// are not available through the standard library
+func checkPeer(conn net.Conn) error {
+	return nil
+}
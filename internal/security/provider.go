@@ -0,0 +1,162 @@
+package security
+
+import (
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Key provider names, as used in key.json and on the command line
+const (
+	ProviderKeyring    = "keyring"
+	ProviderPassphrase = "passphrase"
+	ProviderKeyFile    = "keyfile"
+)
+
+// KeyProvider supplies the master key that encrypts profile secrets.
+type KeyProvider interface {
+	// Name identifies the provider in key.json and status output
+	Name() string
+	// LoadKey returns the master key, generating and storing one if there is none yet
+	LoadKey() ([]byte, error)
+	// StoreKey makes key the provider's master key
+	StoreKey(key []byte) error
+	// DeleteKey removes the master key from the provider
+	DeleteKey() error
+}
+
+// KeyConfig selects and parameterises the key provider. It lives in key.json
+// next to profiles.json; without that file the OS keyring is used.
+type KeyConfig struct {
+	Provider   string            `json:"provider"`
+	KeyFile    string            `json:"key_file,omitempty"`
+	Passphrase *PassphraseParams `json:"passphrase,omitempty"`
+
+	// UseAgent caches the unlocked key in a running 'security agent'
+	UseAgent bool `json:"use_agent,omitempty"`
+	// KeyID is the ID of the master key; a key from the agent must match it
+	KeyID string `json:"key_id,omitempty"`
+
+	// PendingKey is the next master key, encrypted with the current one,
+	// while a rotation is in progress (see BeginRotation)
+	PendingKey   []byte `json:"pending_key,omitempty"`
+	PendingKeyID string `json:"pending_key_id,omitempty"`
+}
+
+var (
+	mu         sync.Mutex
+	configPath string
+	keyConfig  = KeyConfig{Provider: ProviderKeyring}
+	cachedKey  []byte
+	aeadCache  map[string]cipher.AEAD // keyed by master key
+)
+
+// Init loads the key provider configuration from path.
+// A missing file selects the OS keyring.
+func Init(path string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	configPath = path
+	cachedKey = nil
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		keyConfig = KeyConfig{Provider: ProviderKeyring}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read key config: %w", err)
+	}
+
+	var cfg KeyConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("failed to parse key config %s: %w", path, err)
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = ProviderKeyring
+	}
+	keyConfig = cfg
+	return nil
+}
+
+// Config returns the active key configuration
+func Config() KeyConfig {
+	mu.Lock()
+	defer mu.Unlock()
+	return keyConfig
+}
+
+// SaveConfig persists cfg and makes it the active configuration. If cfg
+// changes where the key comes from, the cached key is dropped, so the next
+// GetKey unlocks through the new provider.
+func SaveConfig(cfg KeyConfig) error {
+	mu.Lock()
+	defer mu.Unlock()
+	return saveConfigNoLock(cfg)
+}
+
+func saveConfigNoLock(cfg KeyConfig) error {
+	if configPath == "" {
+		return errors.New("key config path not set, call security.Init first")
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
+		return err
+	}
+	tmpPath := configPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, configPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if !sameKeySource(keyConfig, cfg) {
+		cachedKey = nil
+	}
+	keyConfig = cfg
+	return nil
+}
+
+// sameKeySource reports whether a and b unlock the master key the same way
+func sameKeySource(a, b KeyConfig) bool {
+	if a.Provider != b.Provider || a.KeyFile != b.KeyFile {
+		return false
+	}
+	if a.Passphrase == nil || b.Passphrase == nil {
+		return a.Passphrase == b.Passphrase
+	}
+	return string(a.Passphrase.WrappedKey) == string(b.Passphrase.WrappedKey)
+}
+
+// NewProvider builds the provider described by cfg. Providers that keep
+// state in key.json (passphrase) write it back on StoreKey.
+func NewProvider(cfg KeyConfig) (KeyProvider, error) {
+	return newProvider(cfg)
+}
+
+func newProvider(cfg KeyConfig) (KeyProvider, error) {
+	switch cfg.Provider {
+	case "", ProviderKeyring:
+		return keyringProvider{}, nil
+	case ProviderKeyFile:
+		if cfg.KeyFile == "" {
+			return nil, errors.New("keyfile provider needs key_file to be set")
+		}
+		return keyFileProvider{path: cfg.KeyFile}, nil
+	case ProviderPassphrase:
+		return &passphraseProvider{cfg: cfg}, nil
+	default:
+		return nil, fmt.Errorf("unknown key provider %q", cfg.Provider)
+	}
+}
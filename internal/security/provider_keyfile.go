@@ -0,0 +1,70 @@
+package security
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// keyFileProvider keeps the master key base64-encoded in a file, e.g. one
+// mounted from a CI secret. The file must only be readable by its owner.
+type keyFileProvider struct {
+	path string
+}
+
+func (keyFileProvider) Name() string { return ProviderKeyFile }
+
+// LoadKey reads the key file, creating it with a new key if it doesn't exist.
+func (p keyFileProvider) LoadKey() ([]byte, error) {
+	data, err := os.ReadFile(p.path)
+	if os.IsNotExist(err) {
+		newKey, err := GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.StoreKey(newKey); err != nil {
+			return nil, err
+		}
+		return newKey, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(p.path); err == nil && info.Mode().Perm()&0077 != 0 {
+			return nil, fmt.Errorf("key file %s is accessible by other users (mode %o), run chmod 600", p.path, info.Mode().Perm())
+		}
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("key file %s is not valid base64: %w", p.path, err)
+	}
+	return key, nil
+}
+
+func (p keyFileProvider) StoreKey(key []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p.path), 0700); err != nil {
+		return err
+	}
+	tmpPath := p.path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	if err := os.Rename(tmpPath, p.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	return nil
+}
+
+func (p keyFileProvider) DeleteKey() error {
+	if err := os.Remove(p.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete key file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package security
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/zalando/go-keyring"
+)
+
+// keyringProvider keeps the master key in the OS keyring
+// (Windows Credential Manager, macOS Keychain, Secret Service on Linux).
+type keyringProvider struct{}
+
+func (keyringProvider) Name() string { return ProviderKeyring }
+
+// LoadKey retrieves the master key from the system keyring.
+// If it doesn't exist, it generates a new one and saves it.
+func (p keyringProvider) LoadKey() ([]byte, error) {
+	// Try to get the key from the keyring
+	keyStr, err := keyring.Get(serviceName, userName)
+	if err == nil {
+		return base64.StdEncoding.DecodeString(keyStr)
+	}
+
+	// If not found, generate a new key
+	if errors.Is(err, keyring.ErrNotFound) {
+		newKey, err := GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.StoreKey(newKey); err != nil {
+			return nil, err
+		}
+		return newKey, nil
+	}
+
+	return nil, fmt.Errorf("failed to retrieve key from keyring: %w", err)
+}
+
+func (keyringProvider) StoreKey(key []byte) error {
+	keyBase64 := base64.StdEncoding.EncodeToString(key)
+	if err := keyring.Set(serviceName, userName, keyBase64); err != nil {
+		return fmt.Errorf("failed to save key to keyring: %w", err)
+	}
+	return nil
+}
+
+func (keyringProvider) DeleteKey() error {
+	err := keyring.Delete(serviceName, userName)
+	if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return fmt.Errorf("failed to delete key from keyring: %w", err)
+	}
+	return nil
+}
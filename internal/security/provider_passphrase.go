@@ -0,0 +1,165 @@
+package security
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KDF names for PassphraseParams.KDF
+const (
+	KDFArgon2id = "argon2id"
+	KDFScrypt   = "scrypt"
+)
+
+// PassphraseEnv lets scripts and CI supply the passphrase without a prompt
+const PassphraseEnv = "ANTIGRAVITY_PASSPHRASE"
+
+// ErrPassphraseRequired is returned when the passphrase provider needs a
+// passphrase but neither PassphraseEnv nor PassphraseFunc supplied one.
+var ErrPassphraseRequired = errors.New("passphrase required: set " + PassphraseEnv + " or run interactively")
+
+// ErrWrongPassphrase is returned when the passphrase does not unwrap the master key
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// PassphraseFunc asks the user for the passphrase. confirm is set when a new
+// passphrase is being chosen and should be typed twice. The CLI installs a
+// terminal prompt here; by default only PassphraseEnv is consulted.
+var PassphraseFunc func(confirm bool) (string, error)
+
+// PassphraseParams is what key.json stores for the passphrase provider: the
+// KDF with its salt and cost parameters, and the random master key encrypted
+// with the key derived from the passphrase.
+type PassphraseParams struct {
+	KDF  string `json:"kdf"`
+	Salt []byte `json:"salt"`
+
+	// scrypt
+	N int `json:"n,omitempty"`
+	R int `json:"r,omitempty"`
+	P int `json:"p,omitempty"`
+
+	// argon2id
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory_kib,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+
+	WrappedKey []byte `json:"wrapped_key"`
+}
+
+// DefaultPassphraseParams returns fresh parameters for kdf with a random salt
+func DefaultPassphraseParams(kdf string) (*PassphraseParams, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	switch kdf {
+	case "", KDFArgon2id:
+		return &PassphraseParams{KDF: KDFArgon2id, Salt: salt, Time: 3, Memory: 64 * 1024, Threads: 4}, nil
+	case KDFScrypt:
+		return &PassphraseParams{KDF: KDFScrypt, Salt: salt, N: 1 << 15, R: 8, P: 1}, nil
+	default:
+		return nil, fmt.Errorf("unknown KDF %q (use %s or %s)", kdf, KDFArgon2id, KDFScrypt)
+	}
+}
+
+// deriveKey stretches the passphrase into a key-encryption key
+func (p *PassphraseParams) deriveKey(passphrase string) ([]byte, error) {
+	switch p.KDF {
+	case KDFArgon2id:
+		return argon2.IDKey([]byte(passphrase), p.Salt, p.Time, p.Memory, p.Threads, keySize), nil
+	case KDFScrypt:
+		return scrypt.Key([]byte(passphrase), p.Salt, p.N, p.R, p.P, keySize)
+	default:
+		return nil, fmt.Errorf("unknown KDF %q", p.KDF)
+	}
+}
+
+// passphraseProvider unlocks the master key with a passphrase. It needs no
+// keyring, which makes it usable on headless Linux boxes and CI runners.
+type passphraseProvider struct {
+	cfg KeyConfig
+}
+
+func (*passphraseProvider) Name() string { return ProviderPassphrase }
+
+func (p *passphraseProvider) LoadKey() ([]byte, error) {
+	params := p.cfg.Passphrase
+	if params == nil || len(params.WrappedKey) == 0 {
+		return nil, errors.New("passphrase provider is not initialised, run 'antigravity security init --provider passphrase'")
+	}
+
+	passphrase, err := readPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+
+	kek, err := params.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	key, err := DecryptWithKey(kek, params.WrappedKey)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return key, nil
+}
+
+// StoreKey wraps key with a (new) passphrase under a fresh salt and saves the
+// result to key.json, making this provider the active one.
+func (p *passphraseProvider) StoreKey(key []byte) error {
+	kdf := ""
+	if p.cfg.Passphrase != nil {
+		kdf = p.cfg.Passphrase.KDF
+	}
+	params, err := DefaultPassphraseParams(kdf)
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := readPassphrase(true)
+	if err != nil {
+		return err
+	}
+
+	kek, err := params.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+	params.WrappedKey, err = EncryptWithKey(kek, key)
+	if err != nil {
+		return err
+	}
+
+	p.cfg.Passphrase = params
+	return SaveConfig(p.cfg)
+}
+
+// DeleteKey is a no-op: the wrapped key lives in key.json and disappears
+// as soon as another provider's configuration replaces it.
+func (*passphraseProvider) DeleteKey() error {
+	return nil
+}
+
+func readPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	if PassphraseFunc == nil {
+		return "", ErrPassphraseRequired
+	}
+	passphrase, err := PassphraseFunc(confirm)
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", ErrPassphraseRequired
+	}
+	return passphrase, nil
+}
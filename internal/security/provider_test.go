@@ -0,0 +1,68 @@
+package security
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPassphraseProvider_RoundTrip(t *testing.T) {
+	for _, kdf := range []string{KDFArgon2id, KDFScrypt} {
+		t.Run(kdf, func(t *testing.T) {
+			if err := Init(filepath.Join(t.TempDir(), "key.json")); err != nil {
+				t.Fatalf("Init failed: %v", err)
+			}
+			t.Setenv(PassphraseEnv, "correct horse battery staple")
+
+			params, err := DefaultPassphraseParams(kdf)
+			if err != nil {
+				t.Fatalf("DefaultPassphraseParams failed: %v", err)
+			}
+			provider, _ := NewProvider(KeyConfig{Provider: ProviderPassphrase, Passphrase: params})
+
+			key, _ := GenerateKey()
+			if err := provider.StoreKey(key); err != nil {
+				t.Fatalf("StoreKey failed: %v", err)
+			}
+
+			// StoreKey made the passphrase provider active
+			got, err := GetKey()
+			if err != nil {
+				t.Fatalf("GetKey failed: %v", err)
+			}
+			if !bytes.Equal(got, key) {
+				t.Errorf("Unwrapped key differs from stored key")
+			}
+
+			t.Setenv(PassphraseEnv, "wrong")
+			reloaded, _ := NewProvider(Config())
+			if _, err := reloaded.LoadKey(); !errors.Is(err, ErrWrongPassphrase) {
+				t.Errorf("Expected ErrWrongPassphrase, got %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "master.key")
+	provider := keyFileProvider{path: path}
+
+	key, err := provider.LoadKey()
+	if err != nil {
+		t.Fatalf("LoadKey failed: %v", err)
+	}
+	again, err := provider.LoadKey()
+	if err != nil || !bytes.Equal(key, again) {
+		t.Fatalf("Key file not reused: %v", err)
+	}
+
+	if runtime.GOOS != "windows" {
+		os.Chmod(path, 0644)
+		if _, err := provider.LoadKey(); err == nil {
+			t.Errorf("Expected world-readable key file to be rejected")
+		}
+	}
+}
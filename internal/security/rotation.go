@@ -0,0 +1,142 @@
+package security
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Key rotation happens in three steps so that a crash at any point leaves
+// every blob readable:
+//
+//  1. BeginRotation generates the new key and records it in key.json as
+//     pending, encrypted with the current key.
+//  2. The caller re-wraps all data keys with the new key in one atomic write.
+//     Blobs carry the ID of their key, and KeyForID resolves the pending ID
+//     through the still-current key, so both generations can be read.
+//  3. CommitRotation makes the new key the provider's master key and clears
+//     the pending entry.
+//
+// Running BeginRotation again after an interruption resumes with the same key.
+
+// ErrUnknownKeyID is returned when a blob was encrypted with a key we don't have
+var ErrUnknownKeyID = errors.New("blob was encrypted with an unknown master key")
+
+// KeyID returns a short fingerprint identifying key without revealing it
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// CurrentKeyID returns the ID of the master key
+func CurrentKeyID() (string, error) {
+	key, err := GetKey()
+	if err != nil {
+		return "", err
+	}
+	return KeyID(key), nil
+}
+
+// KeyForID returns the key that blobs tagged with id were encrypted with.
+// An empty id means an untagged blob from before key IDs existed, which can
+// only have been encrypted with the current key.
+func KeyForID(id string) ([]byte, error) {
+	key, err := GetKey()
+	if err != nil {
+		return nil, err
+	}
+	if id == "" || id == KeyID(key) {
+		return key, nil
+	}
+
+	cfg := Config()
+	if cfg.PendingKeyID == id && len(cfg.PendingKey) > 0 {
+		pending, err := DecryptWithKey(key, cfg.PendingKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap pending rotation key: %w", err)
+		}
+		return pending, nil
+	}
+
+	return nil, fmt.Errorf("%w (key ID %s)", ErrUnknownKeyID, id)
+}
+
+// DecryptWithKeyID decrypts a blob tagged with the ID of the key that encrypted it
+func DecryptWithKeyID(id string, data []byte) ([]byte, error) {
+	key, err := KeyForID(id)
+	if err != nil {
+		return nil, err
+	}
+	return DecryptWithKey(key, data)
+}
+
+// PendingRotation returns the key ID of an unfinished rotation, or ""
+func PendingRotation() string {
+	return Config().PendingKeyID
+}
+
+// BeginRotation generates a new master key and records it as pending.
+// If an earlier rotation was interrupted, its key is returned instead and
+// resumed is set.
+func BeginRotation() (newKey []byte, resumed bool, err error) {
+	current, err := GetKey()
+	if err != nil {
+		return nil, false, err
+	}
+
+	cfg := Config()
+	if cfg.PendingKeyID != "" {
+		pending, err := KeyForID(cfg.PendingKeyID)
+		if err != nil {
+			return nil, false, err
+		}
+		return pending, true, nil
+	}
+
+	newKey, err = GenerateKey()
+	if err != nil {
+		return nil, false, err
+	}
+	wrapped, err := EncryptWithKey(current, newKey)
+	if err != nil {
+		return nil, false, err
+	}
+
+	cfg.PendingKey = wrapped
+	cfg.PendingKeyID = KeyID(newKey)
+	if err := SaveConfig(cfg); err != nil {
+		return nil, false, fmt.Errorf("failed to record pending key: %w", err)
+	}
+	return newKey, false, nil
+}
+
+// CommitRotation hands newKey to the key provider as the master key and
+// clears the pending entry. Call it only after every blob was re-encrypted.
+func CommitRotation(newKey []byte) error {
+	provider, err := NewProvider(Config())
+	if err != nil {
+		return err
+	}
+	if err := provider.StoreKey(newKey); err != nil {
+		return fmt.Errorf("failed to store new master key: %w", err)
+	}
+
+	// StoreKey may have rewritten key.json (passphrase provider), start from the saved state
+	cfg := Config()
+	cfg.PendingKey = nil
+	cfg.PendingKeyID = ""
+	cfg.KeyID = KeyID(newKey)
+	if err := SaveConfig(cfg); err != nil {
+		return fmt.Errorf("new master key stored, but failed to clear pending rotation: %w", err)
+	}
+
+	mu.Lock()
+	cachedKey = newKey
+	mu.Unlock()
+
+	if cfg.UseAgent {
+		agentPut(newKey)
+	}
+	return nil
+}
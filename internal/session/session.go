@@ -6,7 +6,7 @@ import (
 	"antigravity-cli/internal/injection"
 	"antigravity-cli/internal/tunnel"
 	"antigravity-cli/internal/utils"
-	"database/sql"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
@@ -32,6 +32,15 @@ type Session struct {
 	configPath  string
 	refreshQuit chan struct{}
 	ideCmd      *exec.Cmd // Handle to the IDE process
+	// ideQuit is closed when we end the IDE ourselves (switch, stop), so its
+	// monitor doesn't take the exit for the user closing it
+	ideQuit     chan struct{}
+	lastRefresh *RefreshEvent
+	// original holds the IDE's credential rows from before the session,
+	// restored when it ends (session.on_end: restore)
+	original *injection.Snapshot
+	// identityEnded is set once EndIDEIdentity ran
+	identityEnded bool
 }
 
 // NewSession creates a new session manager
@@ -52,14 +61,64 @@ func (s *Session) Start(profile config.Profile, port int, cmd *exec.Cmd, singBox
 	
 	// Start background refresh monitor
 	s.refreshQuit = make(chan struct{})
-	go s.monitorTokenExpiry()
+	go s.monitorTokenExpiry(s.refreshQuit)
 	
 	// Start IDE monitor
-	if s.ideCmd != nil {
-		go s.monitorIDE()
+	s.startIDEMonitor()
+}
+
+// startIDEMonitor watches the current IDE process. Call with s.mu held.
+func (s *Session) startIDEMonitor() {
+	if s.ideCmd == nil {
+		return
+	}
+	s.ideQuit = make(chan struct{})
+	go s.monitorIDE(s.ideCmd, s.ideQuit)
+}
+
+// stopIDEMonitor tells the current IDE monitor that the IDE is going away on
+// purpose. Call with s.mu held, before killing the IDE.
+func (s *Session) stopIDEMonitor() {
+	if s.ideQuit != nil {
+		close(s.ideQuit)
+		s.ideQuit = nil
 	}
 }
 
+// RememberIDEState keeps the snapshot taken before the session's first
+// injection, so EndIDEIdentity can give the IDE its own sign-in back
+func (s *Session) RememberIDEState(snap *injection.Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.original = snap
+}
+
+// EndIDEIdentity removes the session's identity from the IDE: with
+// session.on_end "restore" the rows from before the session are written back,
+// with "clear" (or no snapshot) the IDE is signed out. Only the first call
+// does anything.
+func (s *Session) EndIDEIdentity() error {
+	s.mu.Lock()
+	if s.identityEnded {
+		s.mu.Unlock()
+		return nil
+	}
+	s.identityEnded = true
+	original := s.original
+	s.mu.Unlock()
+
+	if config.Current().Session.OnEnd != "restore" || original == nil {
+		fmt.Println("🚪 Signing the IDE out...")
+		return ClearIDECredentials()
+	}
+
+	fmt.Println("↩️ Restoring the IDE sign-in from before the session...")
+	dbPath := utils.GetAntigravityDBPath()
+	return injection.WithSnapshot(dbPath, "session end", func() error {
+		return original.Restore(dbPath)
+	})
+}
+
 // ProfileName returns the current profile name
 func (s *Session) ProfileName() string {
 	s.mu.Lock()
@@ -88,10 +147,15 @@ func (s *Session) SwitchProfile(newProfile config.Profile) error {
 
 	fmt.Println("\n🔄 Switching profile...")
 
-	// 1. KILL IDE first (so it releases DB lock)
+	// 1. KILL IDE first (so it releases DB lock); the DB writes below retry
+	// while it is still shutting down. Its monitor must not end the session.
 	fmt.Println("⏹️ Stopping IDE...")
+	s.stopIDEMonitor()
+	if s.refreshQuit != nil {
+		close(s.refreshQuit)
+		s.refreshQuit = nil
+	}
 	utils.KillAntigravity()
-	time.Sleep(1 * time.Second)
 
 	// 2. STOP old sing-box
 	fmt.Println("⏹️ Stopping old tunnel...")
@@ -155,28 +219,34 @@ func (s *Session) SwitchProfile(newProfile config.Profile) error {
 		if err != nil {
 			fmt.Printf("⚠️ Token refresh failed: %v\n", err)
 		} else {
-			newProfile.AccessToken = tokenResp.AccessToken
-			newProfile.ExpiryTimestamp = time.Now().Unix() + tokenResp.ExpiresIn
 			fmt.Println("✅ Token refreshed!")
-			
+
 			// Save updated profile to store
-			home, _ := os.UserHomeDir()
-			store := config.NewStore(filepath.Join(home, ".antigravity-cli", "profiles.json"))
-			if err := store.Load(); err == nil {
-				store.Profiles[newProfile.Name] = newProfile
-				store.Save()
+			store := config.NewStore(config.StorePath())
+			if err := SaveRefreshedTokens(store, &newProfile, tokenResp); err != nil {
+				fmt.Printf("⚠️ Failed to save refreshed token: %v\n", err)
 			}
 		}
 	}
 
-	// 5. CLEANUP + LOGIN: Clear old credentials then inject new
-	fmt.Println("🚪 Clearing old credentials...")
-	ClearIDECredentials()
+	// 5. LOGIN: Inject new credentials over the old ones. No sign out first:
+	// merge mode keeps the IDE's own agentManagerInitState fields and only
+	// replaces the token info
 	fmt.Println("🔑 Injecting new credentials...")
 	dbPath := utils.GetAntigravityDBPath()
-	if err := injection.InjectIdentity(dbPath, newProfile.AccessToken, newProfile.RefreshToken, newProfile.Email, newProfile.Name); err != nil {
-		fmt.Printf("⚠️ Warning: injection failed: %v\n", err)
+	identity := IdentityFromProfile(newProfile)
+	if err := injection.InjectIdentity(dbPath, identity); err != nil {
+		newCmd.Process.Kill()
+		os.Remove(configPath)
+		return fmt.Errorf("failed to inject identity: %v", err)
 	}
+	// Don't start an IDE that might be signed in as someone else
+	if err := injection.VerifyIdentity(dbPath, identity); err != nil {
+		newCmd.Process.Kill()
+		os.Remove(configPath)
+		return fmt.Errorf("injection verification failed, IDE not started (check 'antigravity db verify'): %v", err)
+	}
+	fmt.Println("✅ Injection verified")
 
 	// 6. Start IDE with new proxy port
 	fmt.Println("🚀 Starting IDE...")
@@ -191,14 +261,13 @@ func (s *Session) SwitchProfile(newProfile config.Profile) error {
 	s.configPath = configPath
 	s.profile = newProfile // Updated to set full profile
 	s.ideCmd = ideCmd
+	s.lastRefresh = nil
 	config.SetActiveProfileName(newProfile.Name)
 	
 	// Restart background monitor
 	s.refreshQuit = make(chan struct{})
-	go s.monitorTokenExpiry()
-	if s.ideCmd != nil {
-		go s.monitorIDE()
-	}
+	go s.monitorTokenExpiry(s.refreshQuit)
+	s.startIDEMonitor()
 
 	fmt.Printf("✅ Switched to profile: %s\n", newProfile.Name)
 	return nil
@@ -219,26 +288,34 @@ func (s *Session) Stop() {
 		s.singBoxCmd.Process.Kill()
 		s.singBoxCmd.Wait()
 	}
+	s.singBoxCmd = nil
 	if s.configPath != "" {
 		os.Remove(s.configPath)
 	}
 
 	// Terminate IDE if still running
+	s.stopIDEMonitor()
 	if s.ideCmd != nil && s.ideCmd.Process != nil {
 		s.ideCmd.Process.Kill() 
 	}
+	s.ideCmd = nil
 }
 
-// monitorIDE waits for the IDE process to exit
-func (s *Session) monitorIDE() {
-	if s.ideCmd == nil {
-		return
-	}
+// monitorIDE waits for the IDE process to exit and ends the session if the
+// user closed it. An exit after quit was closed is our own doing.
+func (s *Session) monitorIDE(ideCmd *exec.Cmd, quit chan struct{}) {
 	// Wait for process to exit
-	s.ideCmd.Wait()
+	ideCmd.Wait()
 
-	// Check if session is still active (not manually stopped)
+	// Check the IDE wasn't stopped by a switch or Stop, and claim the cleanup
 	s.mu.Lock()
+	select {
+	case <-quit:
+		s.mu.Unlock()
+		return
+	default:
+	}
+	s.stopIDEMonitor()
 	isActive := s.singBoxCmd != nil
 	s.mu.Unlock()
 
@@ -249,7 +326,9 @@ func (s *Session) monitorIDE() {
 		// Also we want to clear credentials.
 		// Since this might overlap with manual stop, we should be careful.
 		
-		ClearIDECredentials() // Clear credentials immediately
+		if err := s.EndIDEIdentity(); err != nil { // Remove our credentials immediately
+			fmt.Printf("⚠️ Failed to reset IDE credentials: %v\n", err)
+		}
 		s.Stop() // Stop tunnel
 		
 		// If we are in TUI, this might print over it. 
@@ -265,11 +344,28 @@ func (s *Session) ShowStatus() {
 	s.mu.Lock()
 	port := s.lockedPort
 	name := s.profile.Name
+	expiry := s.profile.ExpiryTimestamp
+	lastRefresh := s.lastRefresh
 	s.mu.Unlock()
 
 	fmt.Printf("\n📊 Session Status\n")
 	fmt.Printf("   Profile: %s\n", name)
 	fmt.Printf("   Port: %d\n", port)
+	fmt.Printf("   Token expires: %s\n", time.Unix(expiry, 0).Format("2006-01-02 15:04:05"))
+
+	if lastRefresh != nil {
+		at := lastRefresh.Time.Format("15:04:05")
+		switch {
+		case lastRefresh.Err != nil:
+			fmt.Printf("   Last refresh: %s ❌ failed: %v\n", at, lastRefresh.Err)
+		case lastRefresh.SaveErr != nil:
+			fmt.Printf("   Last refresh: %s ⚠️ not saved to the profile: %v\n", at, lastRefresh.SaveErr)
+		case lastRefresh.InjectErr != nil:
+			fmt.Printf("   Last refresh: %s ⚠️ saved, but IDE not updated: %v\n", at, lastRefresh.InjectErr)
+		default:
+			fmt.Printf("   Last refresh: %s ✅ IDE updated\n", at)
+		}
+	}
 
 	// Check public IP through proxy
 	dialer, err := proxy.SOCKS5("tcp", fmt.Sprintf("127.0.0.1:%d", port), nil, proxy.Direct)
@@ -278,90 +374,168 @@ func (s *Session) ShowStatus() {
 		return
 	}
 
+	settings := config.Current()
 	httpClient := &http.Client{
 		Transport: &http.Transport{Dial: dialer.Dial},
-		Timeout:   10 * time.Second,
+		Timeout:   time.Duration(settings.Tunnel.ProbeTimeout),
 	}
 
-	resp, err := httpClient.Get("http://ip-api.com/line/?fields=query,country")
+	resp, err := httpClient.Get(settings.Tunnel.IPInfoURL)
 	if err != nil {
 		fmt.Printf("   Public IP: Connection failed\n")
 		return
 	}
 	defer resp.Body.Close()
 
-	buf := make([]byte, 256)
-	n, _ := resp.Body.Read(buf)
-	fmt.Printf("   Public IP: %s", string(buf[:n]))
+	var ipInfo struct {
+		Query   string `json:"query"`
+		Country string `json:"country"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ipInfo); err != nil {
+		fmt.Printf("   Public IP: Unexpected response\n")
+		return
+	}
+	fmt.Printf("   Public IP: %s (%s)\n", ipInfo.Query, ipInfo.Country)
 }
 
-// monitorTokenExpiry checks token expiry every minute
-func (s *Session) monitorTokenExpiry() {
-	ticker := time.NewTicker(1 * time.Minute)
+// monitorTokenExpiry checks token expiry every session.refresh_check_interval (a minute by default)
+func (s *Session) monitorTokenExpiry(quit chan struct{}) {
+	ticker := time.NewTicker(time.Duration(config.Current().Session.RefreshCheckInterval))
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-s.refreshQuit:
+		case <-quit:
 			return
 		case <-ticker.C:
-			s.checkAndRefresh()
+			s.checkAndRefresh(quit)
 		}
 	}
 }
 
-// checkAndRefresh refreshes token if expiring soon
-func (s *Session) checkAndRefresh() {
+// checkAndRefresh refreshes token if expiring soon and pushes the new token into the IDE.
+// quit is the channel of the monitor calling it, closed once the session stops.
+func (s *Session) checkAndRefresh(quit chan struct{}) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
 
 	// Check if we have a valid profile and running proxy
 	if s.singBoxCmd == nil || s.singBoxCmd.Process == nil {
+		s.mu.Unlock()
 		return
 	}
 
 	now := time.Now().Unix()
 	expiresIn5Min := now + 5*60
 
-	if s.profile.ExpiryTimestamp < expiresIn5Min {
-		// Need refresh
-		// Note: We are holding the lock here, but RefreshAccessTokenViaProxy does network IO.
-		// However, since it's a background task and only runs once an hour, holding the lock briefly is acceptable
-		// to ensure consistency. If it blocks too long, UI might freeze if it calls methods needing lock.
-		// Better to copy needed data and unlock, then refresh, then re-lock to save.
-		
-		refreshToken := s.profile.RefreshToken
-		proxyPort := s.lockedPort
-		profileName := s.profile.Name
-		
-		// Unlock for network request
+	if s.profile.ExpiryTimestamp >= expiresIn5Min {
 		s.mu.Unlock()
-		
-		tokenResp, err := auth.RefreshAccessTokenViaProxy(refreshToken, proxyPort)
-		
-		// Re-lock to save
-		s.mu.Lock()
-		
-		if err != nil {
-			// Just log to debug file if available, or ignore. 
-			// We can't easily print to stdout as it might interfere with TUI.
-			return
-		}
+		return
+	}
 
-		// Update profile in session
-		// Check if profile is still the same (user might have switched while we were refreshing)
-		if s.profile.Name == profileName {
-			s.profile.AccessToken = tokenResp.AccessToken
-			s.profile.ExpiryTimestamp = time.Now().Unix() + tokenResp.ExpiresIn
-			
-			// Save to disk
-			home, _ := os.UserHomeDir()
-			store := config.NewStore(filepath.Join(home, ".antigravity-cli", "profiles.json"))
-			if err := store.Load(); err == nil {
-				store.Profiles[profileName] = s.profile
-				store.Save()
-			}
-		}
+	// Copy what we need and unlock: the refresh goes over the network, and
+	// holding the lock would freeze the session menu meanwhile.
+	refreshToken := s.profile.RefreshToken
+	proxyPort := s.lockedPort
+	profileName := s.profile.Name
+	s.mu.Unlock()
+
+	tokenResp, err := auth.RefreshAccessTokenViaProxy(refreshToken, proxyPort)
+	if err != nil {
+		// We can't easily print to stdout as it might interfere with TUI,
+		// so just remember the failure for ShowStatus.
+		s.recordRefresh(RefreshEvent{Time: time.Now(), Err: err})
+		return
+	}
+
+	expiry := time.Now().Unix() + tokenResp.ExpiresIn
+	if tokenResp.RefreshToken != "" {
+		refreshToken = tokenResp.RefreshToken
+	}
+
+	// The tokens belong to profileName whatever happened meanwhile, save them
+	// so a rotated refresh token isn't lost
+	event := RefreshEvent{Time: time.Now(), Expiry: expiry}
+	store := config.NewStore(config.StorePath())
+	event.SaveErr = store.Update(profileName, func(p *config.Profile) error {
+		p.AccessToken = tokenResp.AccessToken
+		p.RefreshToken = refreshToken
+		p.ExpiryTimestamp = expiry
+		return nil
+	})
+
+	// Hold the lock through the DB write: a switch or the end of the session
+	// must not be overwritten with this profile's token
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.profile.Name != profileName || s.ended(quit) {
+		return
+	}
+	s.profile.AccessToken = tokenResp.AccessToken
+	s.profile.RefreshToken = refreshToken
+	s.profile.ExpiryTimestamp = expiry
+
+	// Push the new token into the running IDE, keeping the rest of its state
+	event.InjectErr = injection.UpdateTokens(utils.GetAntigravityDBPath(), tokenResp.AccessToken, refreshToken, expiry)
+	s.lastRefresh = &event
+}
+
+// ended reports whether the session whose refresh monitor got quit is over.
+// Call with s.mu held.
+func (s *Session) ended(quit chan struct{}) bool {
+	select {
+	case <-quit:
+		return true
+	default:
+	}
+	return s.singBoxCmd == nil || s.identityEnded
+}
+
+// RefreshEvent describes the outcome of the last background token refresh
+type RefreshEvent struct {
+	Time      time.Time
+	Expiry    int64
+	Err       error // refresh request failed
+	SaveErr   error // token refreshed but not saved to the profile store
+	InjectErr error // token refreshed but the IDE database was not updated
+}
+
+func (s *Session) recordRefresh(event RefreshEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRefresh = &event
+}
+
+// SaveRefreshedTokens copies a token refresh into p, keeping the new refresh
+// token when Google rotated it, and saves the tokens to the store
+func SaveRefreshedTokens(store *config.Store, p *config.Profile, tokenResp *auth.TokenResponse) error {
+	p.AccessToken = tokenResp.AccessToken
+	p.ExpiryTimestamp = time.Now().Unix() + tokenResp.ExpiresIn
+	if tokenResp.RefreshToken != "" {
+		p.RefreshToken = tokenResp.RefreshToken
+	}
+	return store.Update(p.Name, func(stored *config.Profile) error {
+		stored.AccessToken = p.AccessToken
+		stored.RefreshToken = p.RefreshToken
+		stored.ExpiryTimestamp = p.ExpiryTimestamp
+		return nil
+	})
+}
+
+// IdentityFromProfile builds what gets injected into the IDE for a profile.
+// The Google display name is preferred, falling back to the profile name.
+func IdentityFromProfile(p config.Profile) injection.Identity {
+	name := p.DisplayName
+	if name == "" {
+		name = p.Name
+	}
+	return injection.Identity{
+		AccessToken:  p.AccessToken,
+		RefreshToken: p.RefreshToken,
+		Email:        p.Email,
+		Name:         name,
+		AvatarURL:    p.AvatarURL,
+		Expiry:       injection.UnixExpiry(p.ExpiryTimestamp),
+		Mode:         injection.InjectMode(config.Current().IDE.InjectMode),
 	}
 }
 
@@ -385,31 +559,10 @@ func unblockIDE() {
 		"name=AntigravityBlock").Run()
 }
 
-// ClearIDECredentials simulates a real "Sign Out" by matching what the app does:
-// 1. Delete antigravity.profileUrl
-// 2. Set antigravityAuthStatus to "null" (string)
-// 3. Reset jetskiStateSync.agentManagerInitState to minimal protobuf "mgEA"
+// ClearIDECredentials simulates a real "Sign Out" by matching what the app does,
+// see injection.ClearIdentity
 func ClearIDECredentials() error {
-	dbPath := utils.GetAntigravityDBPath()
-	db, err := sql.Open("sqlite", dbPath)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-
-	// 1. Delete profile avatar
-	db.Exec("DELETE FROM ItemTable WHERE key = ?", "antigravity.profileUrl")
-	
-	// 2. Set auth status to "null" string (not NULL!)
-	db.Exec("UPDATE ItemTable SET value = ? WHERE key = ?", "null", "antigravityAuthStatus")
-	
-	// 3. Reset protobuf to empty state "mgEA" (base64 of minimal protobuf)
-	db.Exec("UPDATE ItemTable SET value = ? WHERE key = ?", "mgEA", "jetskiStateSync.agentManagerInitState")
-	
-	// 4. Also delete google.antigravity cache
-	db.Exec("DELETE FROM ItemTable WHERE key = ?", "google.antigravity")
-
-	return nil
+	return injection.ClearIdentity(utils.GetAntigravityDBPath())
 }
 
 // verifyConnection checks if the tunnel is working
@@ -419,12 +572,13 @@ func verifyConnection(port int) bool {
 		return false
 	}
 
+	settings := config.Current()
 	httpClient := &http.Client{
 		Transport: &http.Transport{Dial: dialer.Dial},
-		Timeout:   15 * time.Second,
+		Timeout:   time.Duration(settings.Tunnel.ProbeTimeout),
 	}
 
-	resp, err := httpClient.Get("http://clients3.google.com/generate_204")
+	resp, err := httpClient.Get(settings.Tunnel.ProbeURL)
 	if err != nil {
 		return false
 	}
@@ -445,8 +599,21 @@ func FindFreePort(min, max int) int {
 	return min
 }
 
+// FreeTunnelPort finds an available port in the configured tunnel port range
+func FreeTunnelPort() int {
+	settings := config.Current()
+	return FindFreePort(settings.Tunnel.PortMin, settings.Tunnel.PortMax)
+}
+
 // GetSingBoxPath finds the sing-box executable
 func GetSingBoxPath() (string, error) {
+	if configured := config.Current().Tunnel.SingBoxPath; configured != "" {
+		if _, err := os.Stat(configured); err != nil {
+			return "", fmt.Errorf("sing-box not found at tunnel.sing_box_path %s: %v", configured, err)
+		}
+		return configured, nil
+	}
+
 	// Try alongside executable
 	ex, err := os.Executable()
 	if err == nil {
@@ -0,0 +1,160 @@
+package session
+
+import (
+	"antigravity-cli/internal/config"
+	"antigravity-cli/internal/injection"
+	"database/sql"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// setupIDE points the settings at a temp IDE database signed in as the user's
+// own account, snapshots it and injects a profile over it, like connect does
+func setupIDE(t *testing.T) (*injection.Snapshot, string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := config.InitSettings(dir); err != nil {
+		t.Fatalf("InitSettings failed: %v", err)
+	}
+	dbPath := filepath.Join(dir, "state.vscdb")
+	if err := config.SetSetting("ide.db_path", dbPath); err != nil {
+		t.Fatalf("SetSetting failed: %v", err)
+	}
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create db: %v", err)
+	}
+	db.Exec("CREATE TABLE ItemTable (key TEXT PRIMARY KEY, value TEXT)")
+	db.Exec("INSERT INTO ItemTable (key, value) VALUES (?, ?)", "antigravityAuthStatus", `{"email":"me@example.com"}`)
+	db.Close()
+
+	snap, err := injection.TakeSnapshot(dbPath, "before session")
+	if err != nil {
+		t.Fatalf("TakeSnapshot failed: %v", err)
+	}
+	if err := injection.InjectIdentity(dbPath, injection.Identity{AccessToken: "a", Email: "profile@example.com"}); err != nil {
+		t.Fatalf("InjectIdentity failed: %v", err)
+	}
+	return snap, dbPath
+}
+
+func authStatus(t *testing.T, dbPath string) string {
+	t.Helper()
+	value, _, err := injection.ReadItem(dbPath, "antigravityAuthStatus")
+	if err != nil {
+		t.Fatalf("ReadItem failed: %v", err)
+	}
+	return value
+}
+
+func TestEndIDEIdentity_Restore(t *testing.T) {
+	snap, dbPath := setupIDE(t)
+	s := NewSession()
+	s.RememberIDEState(snap)
+
+	if err := s.EndIDEIdentity(); err != nil {
+		t.Fatalf("EndIDEIdentity failed: %v", err)
+	}
+	if got := authStatus(t, dbPath); got != `{"email":"me@example.com"}` {
+		t.Errorf("Expected the original account back, got %s", got)
+	}
+	if _, ok, _ := injection.ReadItem(dbPath, "jetskiStateSync.agentManagerInitState"); ok {
+		t.Error("Rows the session created should be gone")
+	}
+
+	// A second call (IDE monitor and disconnect racing) must not write again
+	injection.InjectIdentity(dbPath, injection.Identity{AccessToken: "b", Email: "later@example.com"})
+	if err := s.EndIDEIdentity(); err != nil {
+		t.Fatalf("EndIDEIdentity failed: %v", err)
+	}
+	if got := authStatus(t, dbPath); got == `{"email":"me@example.com"}` {
+		t.Error("Second EndIDEIdentity restored again")
+	}
+}
+
+func TestEndIDEIdentity_Clear(t *testing.T) {
+	snap, dbPath := setupIDE(t)
+	if err := config.SetSetting("session.on_end", "clear"); err != nil {
+		t.Fatalf("SetSetting failed: %v", err)
+	}
+	s := NewSession()
+	s.RememberIDEState(snap)
+
+	if err := s.EndIDEIdentity(); err != nil {
+		t.Fatalf("EndIDEIdentity failed: %v", err)
+	}
+	if got := authStatus(t, dbPath); got != "null" {
+		t.Errorf("Expected the IDE signed out, got %s", got)
+	}
+}
+
+func TestMonitorIDE_OnlyEndsSessionWhenUserClosesIDE(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("needs sleep")
+	}
+	snap, dbPath := setupIDE(t)
+
+	startIDE := func() *exec.Cmd {
+		cmd := exec.Command("sleep", "10")
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("Failed to start fake IDE: %v", err)
+		}
+		return cmd
+	}
+	s := NewSession()
+	s.RememberIDEState(snap)
+	s.singBoxCmd = exec.Command("sing-box") // never started, Stop has nothing to kill
+
+	// Killed by a switch: the monitor was told and leaves everything alone
+	ide := startIDE()
+	quit := make(chan struct{})
+	s.ideCmd, s.ideQuit = ide, quit
+	s.stopIDEMonitor()
+	ide.Process.Kill()
+	s.monitorIDE(ide, quit)
+	if got := authStatus(t, dbPath); got == `{"email":"me@example.com"}` {
+		t.Fatal("Monitor restored the IDE after a deliberate kill")
+	}
+	if s.singBoxCmd == nil {
+		t.Fatal("Monitor stopped the session after a deliberate kill")
+	}
+
+	// Closed by the user: the original account comes back and the session stops
+	ide = startIDE()
+	quit = make(chan struct{})
+	s.ideCmd, s.ideQuit = ide, quit
+	ide.Process.Kill()
+	s.monitorIDE(ide, quit)
+	if got := authStatus(t, dbPath); got != `{"email":"me@example.com"}` {
+		t.Errorf("Expected the original account back, got %s", got)
+	}
+	if s.singBoxCmd != nil {
+		t.Error("Session not stopped after the IDE closed")
+	}
+}
+
+func TestEnded_RefreshSkipsStoppedSession(t *testing.T) {
+	quit := make(chan struct{})
+	s := &Session{singBoxCmd: exec.Command("sing-box")}
+	if s.ended(quit) {
+		t.Fatal("running session reported as ended")
+	}
+
+	s.identityEnded = true
+	if !s.ended(quit) {
+		t.Error("session with its identity ended still takes refreshed tokens")
+	}
+
+	s = &Session{}
+	if !s.ended(quit) {
+		t.Error("stopped session still takes refreshed tokens")
+	}
+
+	s = &Session{singBoxCmd: exec.Command("sing-box")}
+	close(quit)
+	if !s.ended(quit) {
+		t.Error("session still takes refreshed tokens after its monitor was quit")
+	}
+}
@@ -0,0 +1,69 @@
+package session
+
+import (
+	"antigravity-cli/internal/config"
+	"antigravity-cli/internal/tunnel"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Tunnel is a short-lived sing-box instance for talking to Google through a
+// profile's proxy outside of a full session (revoking, introspecting tokens, ...)
+type Tunnel struct {
+	Port       int
+	cmd        *exec.Cmd
+	configPath string
+}
+
+// OpenTunnel starts sing-box for the given profile on a free local port and
+// verifies that traffic actually flows through it.
+func OpenTunnel(profile config.Profile) (*Tunnel, error) {
+	singBoxExec, err := GetSingBoxPath()
+	if err != nil {
+		return nil, err
+	}
+
+	port := FreeTunnelPort()
+	configPath, err := tunnel.GenerateConfig(tunnel.ProxyConfig{
+		ListenPort:      port,
+		ProxyType:       profile.ProxyScheme,
+		ProxyHost:       profile.ProxyHost,
+		ProxyPort:       profile.ProxyPort,
+		ProxyUser:       profile.ProxyUser,
+		ProxyPass:       profile.ProxyPass,
+		UseSystemTunnel: profile.UseSystemTunnel,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate config: %v", err)
+	}
+
+	cmd := exec.Command(singBoxExec, "run", "-c", configPath)
+	if err := cmd.Start(); err != nil {
+		os.Remove(configPath)
+		return nil, fmt.Errorf("failed to start sing-box: %v", err)
+	}
+
+	t := &Tunnel{Port: port, cmd: cmd, configPath: configPath}
+
+	// Wait for sing-box to start
+	time.Sleep(500 * time.Millisecond)
+
+	if !verifyConnection(port) {
+		t.Close()
+		return nil, fmt.Errorf("tunnel for profile '%s' is not working", profile.Name)
+	}
+	return t, nil
+}
+
+// Close stops sing-box and removes its config
+func (t *Tunnel) Close() {
+	if t.cmd != nil && t.cmd.Process != nil {
+		t.cmd.Process.Kill()
+		t.cmd.Wait()
+	}
+	if t.configPath != "" {
+		os.Remove(t.configPath)
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"antigravity-cli/internal/config"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -8,7 +9,12 @@ import (
 
 // GetAntigravityDBPath returns the path to the state.vscdb file.
 // It searches in standard VS Code / Antigravity locations.
+// ide.db_path in config.yaml overrides the search.
 func GetAntigravityDBPath() string {
+	if configured := config.Current().IDE.DBPath; configured != "" {
+		return configured
+	}
+
 	var configDir string
 	home, _ := os.UserHomeDir()
 
@@ -36,7 +42,12 @@ func GetAntigravityDBPath() string {
 }
 
 // GetAntigravityPath returns the path to the IDE executable.
+// ide.path in config.yaml overrides the search.
 func GetAntigravityPath() string {
+	if configured := config.Current().IDE.Path; configured != "" {
+		return configured
+	}
+
 	// This function tries to find the executable path.
 	// In a real scenario, this might need more robust lookup or configuration.
 	// For now, checks common locations.